@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	app "github.com/tedsmitt/ecsgo/internal"
+)
+
+// cpCmd copies files and directories between the local machine and a container
+var cpCmd = &cobra.Command{
+	Use:   "cp <source> <destination>",
+	Short: "Copy files and directories to and from a container",
+	Long: `Copies a file or directory between the local machine and a container over an execute-command session.
+Container paths are given as task/container:path, where the task and container are optional and are otherwise
+taken from the flags or prompted for, e.g. :/tmp/dump.sql. Local paths may optionally be prefixed with local:.
+
+Data is streamed base64 encoded over a single session and verified against a SHA-256 checksum, and directories
+are transferred as tar archives. The container must have sh, sed, base64, sha256sum and tar available.`,
+	Example: `  ecsgo cp --cluster my-cluster ./config.yaml 0123456789abcdef/app:/etc/app/config.yaml
+  ecsgo cp --cluster my-cluster --service api :/var/log/app ./logs`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := app.Copy(args[0], args[1]); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cpCmd)
+}
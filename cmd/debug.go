@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	app "github.com/tedsmitt/ecsgo/internal"
+)
+
+// debugCmd launches a new task from a service and connects to it
+var debugCmd = &cobra.Command{
+	Use:   "debug",
+	Short: "Launch a new task from a service and connect to it",
+	Long: `Launches a new task from the service's current task definition, with the same network configuration,
+launch type (or capacity provider strategy) and placement as the service but with execute command enabled, so
+that you can debug without connecting to a task which is serving traffic. Once the task is running and ready for
+ECS Exec you are connected to it as usual, and the task is stopped when the session ends unless --keep is set.
+
+The task isn't registered with the service's load balancers, but otherwise starts the same way as the service's
+tasks. Set --sleep to replace the command of the container (given with --container, or the first essential
+container) with 'sleep infinity' so that it idles instead.`,
+	Example: `  ecsgo debug --cluster my-cluster --service api
+  ecsgo debug --cluster my-cluster --service worker --sleep --keep`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		keep, _ := cmd.Flags().GetBool("keep")
+		sleep, _ := cmd.Flags().GetBool("sleep")
+		if err := app.Debug(keep, sleep); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+func init() {
+	debugCmd.Flags().Bool("keep", false, "Leave the debug task running when the session ends")
+	debugCmd.Flags().Bool("sleep", false, "Override the container's command with 'sleep infinity'")
+	rootCmd.AddCommand(debugCmd)
+}
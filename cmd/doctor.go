@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	app "github.com/tedsmitt/ecsgo/internal"
+)
+
+// doctorCmd checks the pre-requisites for ECS Exec against a task
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose why ECS Exec isn't working for a task",
+	Long: `Prompts for a task, or uses the task given with --task, and checks the pre-requisites for connecting to it with
+ECS Exec: that execute command is enabled on the task, that the ExecuteCommandAgent is running in each container,
+that the task definition has a task role, that Fargate tasks are on platform version 1.4.0 or later, and how the
+cluster's execute command configuration encrypts and logs sessions. Each check is reported as passed or failed,
+along with a hint on how to fix it.`,
+	Example: `  ecsgo doctor --cluster my-cluster --service api`,
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := app.Doctor(); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	app "github.com/tedsmitt/ecsgo/internal"
+)
+
+// execCmd resolves the target container from flags alone and never opens a prompt, making it usable from
+// scripts, CI jobs and runbooks
+var execCmd = &cobra.Command{
+	Use:   "exec [target]",
+	Short: "Non-interactively execute a command on a container resolved from flags",
+	Long: `Resolves the cluster, service, task and container from the supplied flags (or environment variables)
+without prompting. If a value is omitted and exactly one candidate exists it is used, otherwise the command
+exits with an "ambiguous target" error listing the candidates.`,
+	Args:        cobra.MaximumNArgs(1),
+	Annotations: map[string]string{targetArgAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		viper.Set("non-interactive", true)
+		viper.Set("forward", false)
+
+		a := app.CreateApp()
+		if err := a.Start(); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+}
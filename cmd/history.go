@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	app "github.com/tedsmitt/ecsgo/internal"
+)
+
+// historyCmd lists recent connections and reconnects to the chosen one
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List recent connections and choose one to reconnect to",
+	Long: `Lists recent connections and prompts you to choose one to reconnect to. As task IDs change with every
+deployment, a task currently running the same service (or task definition family) and container is used.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		history, err := app.LoadHistory()
+		if err != nil {
+			exitWithError(err)
+		}
+		if len(history) == 0 {
+			exitWithError(errors.New("no connections have been recorded yet"))
+		}
+
+		if list, _ := cmd.Flags().GetBool("list"); list {
+			for i, h := range history {
+				fmt.Printf("%3d  %s\n", i+1, h)
+			}
+			return
+		}
+
+		entry, err := app.SelectHistory(history)
+		if err != nil {
+			exitWithError(err)
+		}
+		if err := app.Reconnect(entry, cmd.Flags().Changed); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+// lastCmd reconnects to the most recent connection
+var lastCmd = &cobra.Command{
+	Use:   "last",
+	Short: "Reconnect to the most recent connection",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		history, err := app.LoadHistory()
+		if err != nil {
+			exitWithError(err)
+		}
+		if len(history) == 0 {
+			exitWithError(errors.New("no connections have been recorded yet"))
+		}
+		if err := app.Reconnect(history[0], cmd.Flags().Changed); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+// exitWithError prints the error to stderr and exits with the exit code for the error
+func exitWithError(err error) {
+	fmt.Fprintf(os.Stderr, "\n%s\n", app.Red(err))
+	os.Exit(app.ExitCode(err))
+}
+
+func init() {
+	historyCmd.Flags().Bool("list", false, "Print recent connections without prompting")
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(lastCmd)
+}
@@ -26,11 +26,18 @@ import (
 )
 
 func main() {
-	rootCmd.Execute()
+	// Commands exit themselves once they've run, so any error returned here is from parsing or validating the
+	// flags and arguments. Cobra has already printed it.
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(app.ExitCode(&app.UsageError{Err: err}))
+	}
 }
 
 var cfgFile string
 
+// targetArgAnnotation marks commands which accept a named target from the config file as their argument
+const targetArgAnnotation = "ecsgo/target-arg"
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "ecsgo",
@@ -50,67 +57,174 @@ of the ECS ExecuteCommand API under the hood.
 Requires pre-existing installation of the session-manager-plugin
 (https://docs.aws.amazon.com/systems-manager/latest/userguide/session-manager-working-with-install-plugin.html)
 ------------`,
+	Args: cobra.MaximumNArgs(1),
+	// Allow a named target from the config file to be passed as an argument, e.g. `ecsgo api-prod`
+	Annotations: map[string]string{targetArgAnnotation: "true"},
 	// Validate args
-	PreRunE: func(cmd *cobra.Command, args []string) error {
-		cluster := cmd.PersistentFlags().Lookup("cluster")
-		service := cmd.PersistentFlags().Lookup("service")
-		task := cmd.PersistentFlags().Lookup("task")
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		viper.SetEnvPrefix("ECSGO")
+		viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+		viper.AutomaticEnv()
+
+		// Load the named target, if any, with explicitly set flags taking precedence over its values
+		target := viper.GetString("target")
+		if target == "" && len(args) == 1 && cmd.Annotations[targetArgAnnotation] == "true" {
+			target = args[0]
+		}
+		if target != "" {
+			if err := app.ApplyTarget(target, cmd.Flags().Changed); err != nil {
+				return fmt.Errorf(app.Red(err))
+			}
+		}
+
+		cluster := viper.GetString("cluster")
+		service := viper.GetString("service")
+		task := viper.GetString("task")
 
-		if cluster.Value.String() == "" {
-			if task.Value.String() != "" {
+		if cluster == "" {
+			if task != "" {
 				return fmt.Errorf(app.Red("Cluster name must be specified when specifying task"))
 			}
-			if service.Value.String() != "" {
+			if service != "" {
 				return fmt.Errorf(app.Red("Cluster name must be specified when specifying service"))
 			}
 		}
-		if task.Value.String() != "" && service.Value.String() != "" {
+		if viper.GetString("role-arn") == "" && (viper.GetString("external-id") != "" || viper.GetString("mfa-serial") != "" || viper.GetString("role-session-name") != "") {
+			return fmt.Errorf(app.Red("--external-id, --mfa-serial and --role-session-name can only be used with --role-arn"))
+		}
+		if err := app.ValidateTaskFilter(); err != nil {
+			return fmt.Errorf(app.Red(err))
+		}
+		if viper.GetBool("all-tasks") && viper.GetBool("forward") {
+			return fmt.Errorf(app.Red("--all-tasks cannot be used with --forward"))
+		}
+		if output := strings.ToLower(viper.GetString("output")); output != "" && output != "text" && output != "json" {
+			return fmt.Errorf(app.Red("Output format must be one of text, json"))
+		}
+		switch viper.GetString("session-client") {
+		case "auto", "plugin", "native":
+		default:
+			return fmt.Errorf(app.Red("Session client must be one of auto, plugin, native"))
+		}
+		if task != "" && service != "" {
 			fmt.Printf(fmt.Sprintf("%s\n", app.Yellow("The service argument will be ignored when task is specified")))
 			viper.Set("service", "")
 		}
 
-		viper.SetEnvPrefix("ECSGO")
-		viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
-		viper.AutomaticEnv()
+		// Forwarding to a remote host is always done through a port-forward session
+		if viper.GetString("remote-host") != "" {
+			viper.Set("forward", true)
+		}
 
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		a := app.CreateApp()
 		if err := a.Start(); err != nil {
-			fmt.Printf("\n%s\n", app.Red(err))
-			os.Exit(1)
+			exitWithError(err)
 		}
 	},
 	Version: getVersion(),
 }
 
 func init() {
+	cobra.OnInitialize(initConfig)
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "Config file (default is $HOME/.config/ecsgo/config.yaml)")
+	rootCmd.PersistentFlags().String("target", "", "Named target from the config file to connect to")
 	rootCmd.PersistentFlags().StringP("cmd", "c", "", "Command to run on the container")
 	rootCmd.PersistentFlags().StringP("profile", "p", "", "AWS Profile")
+	rootCmd.PersistentFlags().String("role-arn", "", "ARN of a role to assume using the profile's credentials")
+	rootCmd.PersistentFlags().String("external-id", "", "External ID to pass when assuming --role-arn")
+	rootCmd.PersistentFlags().String("role-session-name", "", "Session name to use when assuming --role-arn (default ecsgo-<timestamp>)")
+	rootCmd.PersistentFlags().String("mfa-serial", "", "Serial number or ARN of the MFA device required to assume --role-arn")
 	rootCmd.PersistentFlags().StringP("region", "r", "", "AWS Region")
+	rootCmd.PersistentFlags().StringSlice("profiles", nil, "Comma separated profiles (or glob patterns such as prod-*) to list clusters in")
 	rootCmd.PersistentFlags().StringP("cluster", "n", "", "Cluster Name")
+	rootCmd.PersistentFlags().Bool("all-regions", false, "List clusters in every region enabled in the account")
+	rootCmd.PersistentFlags().StringSlice("regions", nil, "Comma separated regions to list clusters in")
+	rootCmd.PersistentFlags().Bool("show-inactive", false, "Include INACTIVE clusters in the cluster picker")
 	rootCmd.PersistentFlags().StringP("service", "s", "", "Service Name")
 	rootCmd.PersistentFlags().StringP("task", "t", "", "Task ID")
+	rootCmd.PersistentFlags().String("desired-status", "", "Only list tasks with this desired status: RUNNING, PENDING or STOPPED")
+	rootCmd.PersistentFlags().String("launch-type", "", "Only list tasks with this launch type: FARGATE, EC2 or EXTERNAL")
+	rootCmd.PersistentFlags().String("task-def", "", "Only list tasks running this task definition family, optionally with a revision, e.g. myapp:42")
+	rootCmd.PersistentFlags().StringSlice("tag", nil, "Only list tasks with this tag, given as key=value (can be repeated)")
+	rootCmd.PersistentFlags().String("started-after", "", "Only list tasks started within this duration (e.g. 1h) or after this RFC3339 timestamp")
+	rootCmd.PersistentFlags().String("az", "", "Only list tasks in this availability zone")
 	rootCmd.PersistentFlags().StringP("container", "u", "", "Container name")
 	rootCmd.PersistentFlags().BoolP("forward", "f", false, "Port Forward")
 	rootCmd.PersistentFlags().StringP("local-port", "l", "", "Local port for use with port forwarding")
 	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Do not print cluster and container information")
 	rootCmd.PersistentFlags().StringP("aws-endpoint-url", "e", "", "AWS Endpoint Url")
-
+	rootCmd.PersistentFlags().BoolP("all-tasks", "a", false, "Run the command on every matching task in parallel")
+	rootCmd.PersistentFlags().Int("concurrency", 5, "Maximum number of concurrent sessions when used with --all-tasks")
+	rootCmd.PersistentFlags().StringP("output", "o", "", "Capture the output of --cmd and print it as text or json")
+	rootCmd.PersistentFlags().String("output-dir", "", "Capture the output of --cmd and write it to a file per task in this directory")
+	rootCmd.PersistentFlags().String("session-client", "auto", "Client used to connect to sessions: auto, plugin or native")
+	rootCmd.PersistentFlags().String("remote-host", "", "Port forward to this host through the task (implies --forward)")
+	rootCmd.PersistentFlags().String("remote-port", "", "Port on the remote host to forward to")
+	rootCmd.PersistentFlags().String("port", "", "Comma separated local:remote ports to forward, e.g. 8080:80,9090:9000")
+	rootCmd.PersistentFlags().Bool("reconnect", false, "Automatically reconnect port-forward sessions, switching to a healthy task in the service if needed")
+	rootCmd.PersistentFlags().Int("max-retries", 5, "Maximum number of consecutive reconnect attempts when used with --reconnect")
+
+	viper.BindPFlag("target", rootCmd.PersistentFlags().Lookup("target"))
 	viper.BindPFlag("cmd", rootCmd.PersistentFlags().Lookup("cmd"))
 	viper.BindPFlag("profile", rootCmd.PersistentFlags().Lookup("profile"))
+	viper.BindPFlag("role-arn", rootCmd.PersistentFlags().Lookup("role-arn"))
+	viper.BindPFlag("external-id", rootCmd.PersistentFlags().Lookup("external-id"))
+	viper.BindPFlag("role-session-name", rootCmd.PersistentFlags().Lookup("role-session-name"))
+	viper.BindPFlag("mfa-serial", rootCmd.PersistentFlags().Lookup("mfa-serial"))
 	viper.BindPFlag("region", rootCmd.PersistentFlags().Lookup("region"))
+	viper.BindPFlag("profiles", rootCmd.PersistentFlags().Lookup("profiles"))
 	viper.BindPFlag("cluster", rootCmd.PersistentFlags().Lookup("cluster"))
+	viper.BindPFlag("all-regions", rootCmd.PersistentFlags().Lookup("all-regions"))
+	viper.BindPFlag("regions", rootCmd.PersistentFlags().Lookup("regions"))
+	viper.BindPFlag("show-inactive", rootCmd.PersistentFlags().Lookup("show-inactive"))
 	viper.BindPFlag("service", rootCmd.PersistentFlags().Lookup("service"))
 	viper.BindPFlag("task", rootCmd.PersistentFlags().Lookup("task"))
+	viper.BindPFlag("desired-status", rootCmd.PersistentFlags().Lookup("desired-status"))
+	viper.BindPFlag("launch-type", rootCmd.PersistentFlags().Lookup("launch-type"))
+	viper.BindPFlag("task-def", rootCmd.PersistentFlags().Lookup("task-def"))
+	viper.BindPFlag("tag", rootCmd.PersistentFlags().Lookup("tag"))
+	viper.BindPFlag("started-after", rootCmd.PersistentFlags().Lookup("started-after"))
+	viper.BindPFlag("az", rootCmd.PersistentFlags().Lookup("az"))
 	viper.BindPFlag("container", rootCmd.PersistentFlags().Lookup("container"))
 	viper.BindPFlag("forward", rootCmd.PersistentFlags().Lookup("forward"))
 	viper.BindPFlag("local-port", rootCmd.PersistentFlags().Lookup("local-port"))
 	viper.BindPFlag("quiet", rootCmd.PersistentFlags().Lookup("quiet"))
 	viper.BindPFlag("aws-endpoint-url", rootCmd.PersistentFlags().Lookup("aws-endpoint-url"))
+	viper.BindPFlag("all-tasks", rootCmd.PersistentFlags().Lookup("all-tasks"))
+	viper.BindPFlag("concurrency", rootCmd.PersistentFlags().Lookup("concurrency"))
+	viper.BindPFlag("output", rootCmd.PersistentFlags().Lookup("output"))
+	viper.BindPFlag("output-dir", rootCmd.PersistentFlags().Lookup("output-dir"))
+	viper.BindPFlag("session-client", rootCmd.PersistentFlags().Lookup("session-client"))
+	viper.BindPFlag("remote-host", rootCmd.PersistentFlags().Lookup("remote-host"))
+	viper.BindPFlag("remote-port", rootCmd.PersistentFlags().Lookup("remote-port"))
+	viper.BindPFlag("port", rootCmd.PersistentFlags().Lookup("port"))
+	viper.BindPFlag("reconnect", rootCmd.PersistentFlags().Lookup("reconnect"))
+	viper.BindPFlag("max-retries", rootCmd.PersistentFlags().Lookup("max-retries"))
+}
+
+// initConfig reads in the config file, if one exists
+func initConfig() {
+	if cfgFile != "" {
+		viper.SetConfigFile(cfgFile)
+	} else {
+		viper.AddConfigPath(app.ConfigDir())
+		viper.SetConfigName("config")
+		viper.SetConfigType("yaml")
+	}
+
+	if err := viper.ReadInConfig(); err != nil {
+		// A missing config file is fine unless it was explicitly specified
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok || cfgFile != "" {
+			fmt.Fprintf(os.Stderr, "%s\n", app.Red(fmt.Sprintf("Unable to read config file: %s", err)))
+			os.Exit(app.ExitUsage)
+		}
+	}
 }
@@ -5,16 +5,19 @@ package app
 import (
 	"context"
 	"errors"
-	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
 	"sort"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"github.com/fatih/color"
@@ -22,296 +25,351 @@ import (
 )
 
 var (
-	region string
-
 	Red     = color.New(color.FgRed).SprintFunc()
 	Magenta = color.New(color.FgMagenta).SprintFunc()
 	Cyan    = color.New(color.FgCyan).SprintFunc()
 	Green   = color.New(color.FgGreen).SprintFunc()
 	Yellow  = color.New(color.FgYellow).SprintFunc()
+	Grey    = color.New(color.FgHiBlack).SprintFunc()
 
-	pageSize      = 15
-	backOpt       = "⏎ Back" // backOpt is used to allow the user to navigate backwards in the selection prompt
-	awsMaxResults = aws.Int32(int32(100))
+	pageSize        = 15
+	backOpt         = "⏎ Back"             // backOpt is used to allow the user to navigate backwards in the selection prompt
+	standaloneTasks = "(standalone tasks)" // standaloneTasks is chosen in the service picker to list tasks which don't belong to a service
+	awsMaxResults   = aws.Int32(int32(100))
 )
 
-// runCommand executes a command in the current shell and returns an error if the command fails
-func runCommand(process string, args ...string) error {
-	if flag.Lookup("test.v") != nil {
-		// emulate successful return for testing purposes
-		return nil
+// CommandRunner runs local commands such as the session-manager-plugin, attached to the supplied
+// stdin/stdout/stderr, and returns their exit code
+type CommandRunner interface {
+	Run(ctx context.Context, stdin io.Reader, stdout io.Writer, stderr io.Writer, process string, args ...string) (int, error)
+}
+
+// execRunner runs commands as child processes of ecsgo
+type execRunner struct{}
+
+// Run executes the command and returns its exit code. The command is sent an interrupt if the context is
+// cancelled before it exits.
+func (execRunner) Run(ctx context.Context, stdin io.Reader, stdout io.Writer, stderr io.Writer, process string, args ...string) (int, error) {
+	stop := discardInterrupts()
+	defer stop()
+
+	cmd := exec.Command(process, args...)
+	cmd.Stderr = stderr
+	cmd.Stdout = stdout
+	cmd.Stdin = stdin
+
+	if err := cmd.Start(); err != nil {
+		return -1, err
 	}
 
-	// Capture any SIGINTs and discard them
+	exited := make(chan struct{})
+	defer close(exited)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := cmd.Process.Signal(os.Interrupt); err != nil {
+				cmd.Process.Kill()
+			}
+		case <-exited:
+		}
+	}()
+
+	if err := cmd.Wait(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode(), err
+		}
+		return -1, err
+	}
+
+	return 0, nil
+}
+
+// discardInterrupts captures any SIGINTs and discards them so that they are handled by the child process
+// rather than terminating ecsgo. The returned func stops capturing.
+func discardInterrupts() func() {
 	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
 	signal.Notify(sigs, os.Interrupt, syscall.SIGINT)
 	go func() {
 		for {
 			select {
 			case <-sigs:
+			case <-done:
+				return
 			}
 		}
 	}()
-	defer close(sigs)
 
-	cmd := exec.Command(process, args...)
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	cmd.Stdin = os.Stdin
-
-	if err := cmd.Run(); err != nil {
-		return err
+	return func() {
+		signal.Stop(sigs)
+		close(done)
 	}
-
-	return nil
 }
 
 // App is the main struct for the application which holds the state and methods for the application
 type App struct {
-	input     chan string
-	err       chan error
-	exit      chan error
-	client    ECSClient
-	region    string
-	endpoint  string
-	cluster   string
-	service   string
-	task      *ecsTypes.Task
-	tasks     map[string]*ecsTypes.Task
-	container *ecsTypes.Container
+	client         ECSClient
+	profile        string
+	region         string
+	endpoint       string
+	cluster        string
+	service        string
+	task           *ecsTypes.Task
+	tasks          map[string]*ecsTypes.Task
+	container      *ecsTypes.Container
+	prompt         Prompter      // asks the user to choose at each step
+	runner         CommandRunner // runs the session-manager-plugin
+	nonInteractive bool          // when set, targets are resolved from flags alone and the user is never prompted
+	nativeSession  bool          // when set, sessions use the built-in data channel client rather than the session-manager-plugin
+	forwardMu      sync.Mutex    // guards task and container while port-forward sessions are reconnecting
+	clients        ClientFactory
+	copy           *copyRequest  // when set, files are copied to or from the selected container rather than opening a session
+	doctor         bool          // when set, ECS Exec diagnostics are run against the selected task rather than opening a session
+	debug          *debugRequest // when set, a new task is launched from the selected service rather than choosing one
 }
 
 // CreateApp initialises a new App struct with the required initial values
 func CreateApp() *App {
-	client := createEcsClient()
+	prompt := surveyPrompter{}
+	clients := NewClientFactory(prompt)
+	profile := viper.GetString("profile")
+	client, err := clients.ECS(profile, viper.GetString("region"))
+	if err != nil {
+		panic(err)
+	}
+	region, err := clients.Region(profile, viper.GetString("region"))
+	if err != nil {
+		panic(err)
+	}
 	e := &App{
-		input:  make(chan string, 1),
-		err:    make(chan error, 1),
-		exit:   make(chan error, 1),
-		client: client,
-		region: client.Options().Region,
+		client:         client,
+		profile:        profile,
+		region:         region,
+		prompt:         prompt,
+		runner:         execRunner{},
+		nonInteractive: viper.GetBool("non-interactive"),
+		clients:        clients,
 	}
 
 	return e
 }
 
-// Start begins a goroutine that listens on the input channel for instructions
+// Start checks that sessions can be connected to and then runs the app from choosing a cluster through to
+// connecting to the chosen container
 func (e *App) Start() error {
-	// Before we do anything make sure that the session-manager-plugin is available in $PATH, exit if it isn't
+	// Before we do anything make sure that we have a way of connecting to the session. The built-in client is
+	// used if requested, or if the session-manager-plugin isn't available in $PATH and it isn't required.
 	_, err := exec.LookPath("session-manager-plugin")
-	if err != nil {
-		fmt.Println(Red("session-manager-plugin isn't installed or wasn't found in $PATH - https://docs.aws.amazon.com/systems-manager/latest/userguide/session-manager-working-with-install-plugin.html"))
-		return err
-	}
-
-	go func() {
-		for {
-			select {
-			case input := <-e.input:
-				switch input {
-				case "getCluster":
-					e.getCluster()
-				case "getService":
-					e.getService()
-				case "getTask":
-					e.getTask()
-				case "getContainer":
-					e.getContainer()
-				case "execute":
-					if viper.GetBool("forward") {
-						e.executeForward()
-					} else {
-						e.executeCommand()
-					}
-				default:
-					e.getCluster()
-				}
-			case err := <-e.err:
-				e.exit <- err
+	switch strings.ToLower(viper.GetString("session-client")) {
+	case "native":
+		if viper.GetBool("forward") {
+			return errors.New("port forwarding is not supported by the built-in session client, use --session-client plugin")
+		}
+		e.nativeSession = true
+	case "plugin":
+		if err != nil {
+			fmt.Println(Red("session-manager-plugin isn't installed or wasn't found in $PATH - https://docs.aws.amazon.com/systems-manager/latest/userguide/session-manager-working-with-install-plugin.html"))
+			return err
+		}
+	default:
+		if err != nil {
+			if viper.GetBool("forward") {
+				fmt.Println(Red("session-manager-plugin isn't installed or wasn't found in $PATH, it is required for port forwarding - https://docs.aws.amazon.com/systems-manager/latest/userguide/session-manager-working-with-install-plugin.html"))
+				return err
+			}
+			if !viper.GetBool("quiet") {
+				fmt.Println(Yellow("session-manager-plugin wasn't found in $PATH, using the built-in session client"))
 			}
+			e.nativeSession = true
 		}
-	}()
+	}
 
-	// Initiate the workflow
-	e.input <- "getCluster"
+	return e.translateError(e.navigator().run(stepCluster))
+}
 
-	// Block until we receive a message on the exit channel
-	err = <-e.exit
-	if err != nil {
-		return err
+// navigator returns the navigation engine for the steps of the app
+func (e *App) navigator() *navigator {
+	n := &navigator{steps: map[step]func() (transition, error){
+		stepCluster:   e.getCluster,
+		stepService:   e.getService,
+		stepTask:      e.getTask,
+		stepContainer: e.getContainer,
+		stepExecute:   e.execute,
+		stepExecuteFanOut: func() (transition, error) {
+			return done, e.executeFanOut()
+		},
+	}}
+	if e.debug != nil {
+		n.steps[stepTask] = e.launchDebugTask
 	}
 
-	return nil
+	return n
 }
 
-// Lists available clusters and prompts the user to select one
-func (e *App) getCluster() {
-	var clusters []string
-	var nextToken *string
+// execute runs the requested action against the selected container
+func (e *App) execute() (transition, error) {
+	switch {
+	case e.doctor:
+		return done, e.executeDoctor()
+	case e.copy != nil:
+		return done, e.executeCopy()
+	case viper.GetBool("forward"):
+		return done, e.executeForward()
+	default:
+		return done, e.executeCommand()
+	}
+}
 
+// Lists available clusters and prompts the user to select one
+func (e *App) getCluster() (transition, error) {
 	if cluster := viper.GetString("cluster"); cluster != "" {
+		// Clusters in other regions (and profiles) can be given as [profile/]region/cluster, or as an ARN
+		var err error
+		switch split := strings.Split(cluster, "/"); {
+		case strings.HasPrefix(cluster, "arn:"):
+			var parsed arn.ARN
+			parsed, err = arn.Parse(cluster)
+			if err != nil || !strings.HasPrefix(parsed.Resource, "cluster/") {
+				return done, fmt.Errorf("invalid cluster ARN %s", cluster)
+			}
+			err = e.useClient(e.profile, parsed.Region)
+			cluster = strings.TrimPrefix(parsed.Resource, "cluster/")
+		case len(split) == 2:
+			err = e.useClient(e.profile, split[0])
+			cluster = split[1]
+		case len(split) == 3:
+			err = e.useClient(split[0], split[1])
+			cluster = split[2]
+		}
+		if err != nil {
+			return done, err
+		}
 		e.cluster = cluster
 		viper.Set("cluster", "") // Reset the cli arg so user can navigate
 
 		// if task is set, skip ahead to getTask
 		if taskId := viper.GetString("task"); taskId != "" {
-			e.input <- "getTask"
-			return
+			return skip(stepTask), nil
 		}
 
-		e.input <- "getService"
-		return
+		return skip(stepService), nil
 	}
 
-	if e.client == nil {
-		panic("oh no")
-	}
-	list, err := e.client.ListClusters(context.TODO(), &ecs.ListClustersInput{
-		MaxResults: awsMaxResults,
-	})
+	sources, err := e.clusterSources()
 	if err != nil {
-		e.err <- err
-		return
+		return done, err
+	}
+	if len(sources) > 0 {
+		return e.getClusterFromSources(sources)
 	}
-	clusters = append(clusters, list.ClusterArns...)
-	nextToken = list.NextToken
 
-	if nextToken != nil {
-		for {
-			list, err := e.client.ListClusters(context.TODO(), &ecs.ListClustersInput{
-				MaxResults: awsMaxResults,
-				NextToken:  nextToken,
-			})
-			if err != nil {
-				e.err <- err
-				return
-			}
-			clusters = append(clusters, list.ClusterArns...)
-			if list.NextToken == nil {
-				break
-			} else {
-				nextToken = list.NextToken
-			}
-		}
+	arns, err := listClusterArns(e.client)
+	if err != nil {
+		return done, err
 	}
+	clusters, err := describeClusters(e.client, arns)
+	if err != nil {
+		return done, err
+	}
+	clusters = activeClusters(clusters)
 
 	// Sort the list of clusters alphabetically
 	sort.Slice(clusters, func(i, j int) bool {
-		return clusters[i] < clusters[j]
+		return aws.ToString(clusters[i].ClusterName) < aws.ToString(clusters[j].ClusterName)
 	})
 
-	if len(clusters) > 0 {
-		var clusterNames []string
-		for _, c := range clusters {
-			arnSplit := strings.Split(c, "/")
-			name := arnSplit[len(arnSplit)-1]
-			clusterNames = append(clusterNames, name)
-		}
+	if len(clusters) == 0 {
+		return done, errors.New("no clusters found in account or region")
+	}
 
-		selection, err := selectCluster(clusterNames)
-		if err != nil {
-			e.err <- err
-			return
+	var clusterNames []string
+	for _, c := range clusters {
+		clusterNames = append(clusterNames, aws.ToString(c.ClusterName))
+	}
+
+	if e.nonInteractive {
+		if len(clusterNames) > 1 {
+			return done, &AmbiguousTargetError{Resource: "cluster", Candidates: clusterNames}
 		}
+		e.cluster = clusterNames[0]
+		return skip(stepService), nil
+	}
 
-		e.cluster = selection
-		e.input <- "getService"
-		return
+	selection, err := e.prompt.SelectCluster(clusterNames, clusters)
+	if err != nil {
+		return done, err
+	}
+	e.cluster = clusterNames[selection]
 
-	} else {
-		err := errors.New("no clusters found in account or region")
-		e.err <- err
-		return
+	return next(stepService), nil
+}
+
+// activeClusters removes INACTIVE (deleted) clusters, unless --show-inactive is set
+func activeClusters(clusters []ecsTypes.Cluster) []ecsTypes.Cluster {
+	if viper.GetBool("show-inactive") {
+		return clusters
 	}
+	var active []ecsTypes.Cluster
+	for _, c := range clusters {
+		if aws.ToString(c.Status) != "INACTIVE" {
+			active = append(active, c)
+		}
+	}
+	return active
 }
 
 // Lists available services and prompts the user to select one
-func (e *App) getService() {
-	var services []string
-	var nextToken *string
-
+func (e *App) getService() (transition, error) {
 	cliArg := viper.GetString("service")
 	if cliArg != "" {
 		e.service = cliArg
-		e.input <- "getTask"
 		viper.Set("service", "") // Reset the cli arg so user can navigate
-		return
+		return skip(stepTask), nil
 	}
 
-	list, err := e.client.ListServices(context.TODO(), &ecs.ListServicesInput{
-		Cluster:    aws.String(e.cluster),
-		MaxResults: awsMaxResults,
-	})
+	// Without a service we can't prompt, so consider every task in the cluster
+	if e.nonInteractive {
+		return skip(stepTask), nil
+	}
+
+	services, err := listServiceArns(e.client, e.cluster)
 	if err != nil {
-		e.err <- err
-		return
+		return done, err
 	}
-	services = append(services, list.ServiceArns...)
-	nextToken = list.NextToken
 
-	if nextToken != nil {
-		for {
-			list, err := e.client.ListServices(context.TODO(), &ecs.ListServicesInput{
-				Cluster:    aws.String(e.cluster),
-				MaxResults: awsMaxResults,
-				NextToken:  nextToken,
-			})
-			if err != nil {
-				e.err <- err
-				return
-			}
-			services = append(services, list.ServiceArns...)
-			if list.NextToken == nil {
-				break
-			} else {
-				nextToken = list.NextToken
-			}
-		}
+	if len(services) == 0 {
+		// Continue without setting a service if no services are found in the cluster
+		e.service = ""
+		fmt.Printf(Yellow("\n%s"), "No services found in the cluster, returning all running tasks...\n")
+		return skip(stepTask), nil
+	}
+
+	// Describe the services so the picker can show their task counts and deployments
+	described, err := describeServices(e.client, e.cluster, services)
+	if err != nil {
+		return done, err
 	}
 
 	// Sort the list of services alphabetically
-	sort.Slice(services, func(i, j int) bool {
-		return services[i] < services[j]
+	sort.Slice(described, func(i, j int) bool {
+		return aws.ToString(described[i].ServiceName) < aws.ToString(described[j].ServiceName)
 	})
 
-	if len(services) > 0 {
-		var serviceNames []string
-
-		for _, s := range services {
-			arnSplit := strings.Split(s, "/")
-			name := arnSplit[len(arnSplit)-1]
-			serviceNames = append(serviceNames, name)
-		}
-
-		selection, err := selectService(serviceNames)
-		if err != nil {
-			e.err <- err
-			return
-		}
-
-		if selection == backOpt {
-			e.service = ""
-			e.input <- "getCluster"
-			return
-		}
-
-		e.service = selection
-		e.input <- "getTask"
-		return
-
-	} else {
-		// Continue without setting a service if no services are found in the cluster
-		fmt.Printf(Yellow("\n%s"), "No services found in the cluster, returning all running tasks...\n")
-		e.input <- "getTask"
-		return
+	selection, err := e.prompt.SelectService(described)
+	if errors.Is(err, errBack) {
+		e.service = ""
+		return back, nil
+	}
+	if err != nil {
+		return done, err
 	}
+	e.service = selection
+
+	return next(stepTask), nil
 }
 
 // Lists tasks in a cluster and prompts the user to select one
-func (e *App) getTask() {
-	var taskArns []string
-	var nextToken *string
-
+func (e *App) getTask() (transition, error) {
 	var input *ecs.ListTasksInput
 
 	cliArg := viper.GetString("task")
@@ -321,25 +379,31 @@ func (e *App) getTask() {
 			Tasks:   []string{*aws.String(cliArg)},
 		})
 		if err != nil {
-			e.err <- err
-			return
+			return done, err
 		}
-		if len(describe.Tasks) > 0 {
-			e.task = &describe.Tasks[0]
-			e.getContainerOS()
-			e.input <- "getContainer"
-			viper.Set("task", "") // Reset the cli arg so user can navigate
-			return
-		} else {
+		viper.Set("task", "") // Reset the cli arg so user can navigate
+		if len(describe.Tasks) == 0 {
+			if e.nonInteractive {
+				return done, fmt.Errorf("task with ID %s not found in cluster %s", cliArg, e.cluster)
+			}
 			fmt.Println(Red(fmt.Sprintf("\nTask with ID %s not found in cluster %s\n", cliArg, e.cluster)))
-			e.input <- "getService"
-			return
+			return back, nil
 		}
+		e.task = &describe.Tasks[0]
+		if err := e.getContainerOS(); err != nil {
+			return done, err
+		}
+		return skip(stepContainer), nil
 	}
 
-	// If no service has been set, or if ALL (*) services have been selected
+	filter, err := newTaskFilter(time.Now())
+	if err != nil {
+		return done, err
+	}
+
+	// If no service has been set, or if ALL (*) services or standalone tasks have been selected
 	// then we don't need to specify a ServiceName
-	if e.service == "" || e.service == "*" {
+	if e.service == "" || e.service == "*" || e.service == standaloneTasks {
 		input = &ecs.ListTasksInput{
 			Cluster:    aws.String(e.cluster),
 			MaxResults: awsMaxResults,
@@ -351,146 +415,158 @@ func (e *App) getTask() {
 			MaxResults:  awsMaxResults,
 		}
 	}
+	filter.apply(input)
 
-	list, err := e.client.ListTasks(context.TODO(), input)
+	taskArns, err := listTaskArns(e.client, input)
 	if err != nil {
-		e.err <- err
-		return
+		return done, err
 	}
 
-	taskArns = append(taskArns, list.TaskArns...)
-	nextToken = list.NextToken
-
-	if nextToken != nil {
-		for {
-			list, err := e.client.ListTasks(context.TODO(), &ecs.ListTasksInput{
-				Cluster:    aws.String(e.cluster),
-				MaxResults: awsMaxResults,
-				NextToken:  nextToken,
-			})
-			if err != nil {
-				e.err <- err
-				return
-			}
-			taskArns = append(taskArns, list.TaskArns...)
-			if list.NextToken == nil {
-				break
-			} else {
-				nextToken = list.NextToken
-			}
-		}
+	described, err := describeTasks(e.client, e.cluster, taskArns, filter.include())
+	if err != nil {
+		return done, err
 	}
-
 	e.tasks = make(map[string]*ecsTypes.Task)
-	if len(taskArns) > 0 {
-		describe, err := e.client.DescribeTasks(context.TODO(), &ecs.DescribeTasksInput{
-			Cluster: aws.String(e.cluster),
-			Tasks:   taskArns,
-		})
-		if err != nil {
-			e.err <- err
-			return
+	for _, t := range described {
+		if !filter.matches(t) {
+			continue
 		}
-
-		for _, t := range describe.Tasks {
-			task := t
-			taskId := strings.Split(*t.TaskArn, "/")[2]
-			e.tasks[taskId] = &task
+		if e.service == standaloneTasks && !isStandalone(&t) {
+			continue
 		}
+		task := t
+		taskId := strings.Split(*t.TaskArn, "/")[2]
+		e.tasks[taskId] = &task
+	}
 
-		selection, err := selectTask(e.tasks)
-		if err != nil {
-			e.err <- err
-			return
+	if len(e.tasks) == 0 {
+		if e.nonInteractive {
+			return done, fmt.Errorf("no running tasks found matching the supplied flags in cluster %s", e.cluster)
+		}
+		switch {
+		case filter.active():
+			fmt.Println(Red(fmt.Sprintf("\nThere are no tasks matching the task filters in cluster %s\n", e.cluster)))
+		case e.service == "":
+			fmt.Println(Red(fmt.Sprintf("There are no running tasks in the cluster %s\n", e.cluster)))
+		case e.service == standaloneTasks:
+			fmt.Println(Red(fmt.Sprintf("\nThere are no standalone tasks running in the cluster %s\n", e.cluster)))
+		default:
+			fmt.Println(Red(fmt.Sprintf("\nThere are no running tasks for the service %s in cluster %s\n", e.service, e.cluster)))
 		}
+		return back, nil
+	}
 
-		if *selection.TaskArn == backOpt {
-			// e.task = nil
-			if e.service == "" {
-				e.input <- "getCluster"
-				return
+	// Run the command on every task rather than prompting for one
+	if viper.GetBool("all-tasks") {
+		return skip(stepExecuteFanOut), nil
+	}
+
+	if e.nonInteractive {
+		if len(e.tasks) > 1 {
+			var taskIds []string
+			for id := range e.tasks {
+				taskIds = append(taskIds, id)
 			}
-			e.input <- "getService"
-			return
+			sort.Strings(taskIds)
+			return done, &AmbiguousTargetError{Resource: "task", Candidates: taskIds}
 		}
-		e.task = selection
-		e.getContainerOS()
-		e.input <- "getContainer"
-		return
-
-	} else {
-		if e.service == "" {
-			fmt.Println(Red(fmt.Sprintf("There are no running tasks in the cluster %s\n", e.cluster)))
-			e.input <- "getCluster"
-			return
-		} else {
-			fmt.Println(Red(fmt.Sprintf("\nThere are no running tasks for the service %s in cluster %s\n", e.service, e.cluster)))
-			e.input <- "getService"
-			return
+		for _, t := range e.tasks {
+			e.task = t
+		}
+		if err := e.getContainerOS(); err != nil {
+			return done, err
 		}
+		return skip(stepContainer), nil
+	}
+
+	// Tasks without ECS Exec enabled can still be diagnosed
+	selection, err := e.prompt.SelectTask(e.tasks, !e.doctor)
+	if errors.Is(err, errBack) {
+		return back, nil
 	}
+	if err != nil {
+		return done, err
+	}
+	e.task = selection
+	if err := e.getContainerOS(); err != nil {
+		return done, err
+	}
+
+	return next(stepContainer), nil
 }
 
 // Lists containers in a task and prompts the user to select one (if there is more than 1 container)
 // otherwise returns the the only container in the task
-func (e *App) getContainer() {
+func (e *App) getContainer() (transition, error) {
+	// Diagnostics are run against every container in the task
+	if e.doctor {
+		return skip(stepExecute), nil
+	}
+
 	cliArg := viper.GetString("container")
 	if cliArg != "" {
 		for _, c := range e.task.Containers {
 			container := c
 			if *container.Name == cliArg {
 				e.container = &container
-				e.input <- "execute"
-				return
+				return skip(stepExecute), nil
 			}
 		}
+		if e.nonInteractive {
+			return done, fmt.Errorf("container with name %s not found in task %s, cluster %s", cliArg, *e.task.TaskArn, e.cluster)
+		}
 		fmt.Println(Red(fmt.Sprintf("\nSupplied container with name %s not found in task %s, cluster %s\n", cliArg, *e.task.TaskArn, e.cluster)))
 	}
 
-	if len(e.task.Containers) > 1 {
-		selection, err := selectContainer(&e.task.Containers)
-		if err != nil {
-			e.err <- err
-			return
-		}
+	// There is only one container in the task, return it
+	if len(e.task.Containers) == 1 {
+		e.container = &e.task.Containers[0]
+		return skip(stepExecute), nil
+	}
 
-		if *selection.Name == backOpt {
-			e.input <- "getTask"
-			return
+	if e.nonInteractive {
+		var containerNames []string
+		for _, c := range e.task.Containers {
+			containerNames = append(containerNames, *c.Name)
 		}
+		return done, &AmbiguousTargetError{Resource: "container", Candidates: containerNames}
+	}
 
-		e.container = selection
-		e.input <- "execute"
-		return
-
-	} else {
-		// There is only one container in the task, return it
-		e.container = &e.task.Containers[0]
-		e.input <- "execute"
-		return
+	selection, err := e.prompt.SelectContainer(e.task.Containers)
+	if errors.Is(err, errBack) {
+		return back, nil
 	}
+	if err != nil {
+		return done, err
+	}
+	e.container = selection
+
+	return next(stepExecute), nil
 }
 
 // Determines the OS family of the container instance the task is running on
-func (e *App) getContainerOS() {
+func (e *App) getContainerOS() error {
 	// Get associated task definition and determine OS family if EC2 launch-type
 	if e.task.LaunchType == "EC2" {
 		family, err := getPlatformFamily(e.client, e.task)
 		if err != nil {
-			e.err <- err
-			return
+			return err
 		}
 		// if the OperatingSystemFamily has not been specified in the task definition
 		// then we refer to the container instance to determine the OS
 		if family == "" {
-			ec2Client := createEC2Client()
+			ec2Client, err := e.clients.EC2(e.profile, e.region)
+			if err != nil {
+				return err
+			}
 			family, err = getContainerInstanceOS(e.client, ec2Client, e.cluster, *e.task.ContainerInstanceArn)
 			if err != nil {
-				e.err <- err
-				return
+				return err
 			}
 		}
 		// Add our own PlatformFamily value for the task struct
 		e.task.PlatformFamily = &family
 	}
+
+	return nil
 }
@@ -2,13 +2,18 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,18 +23,26 @@ func init() {
 
 type ECSClientMock struct {
 	ListClustersMock               func(ctx context.Context, params *ecs.ListClustersInput, optFns ...func(*ecs.Options)) (*ecs.ListClustersOutput, error)
+	DescribeClustersMock           func(ctx context.Context, params *ecs.DescribeClustersInput, optFns ...func(*ecs.Options)) (*ecs.DescribeClustersOutput, error)
 	ListServicesMock               func(ctx context.Context, params *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error)
 	ListTasksMock                  func(ctx context.Context, params *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error)
+	DescribeServicesMock           func(ctx context.Context, params *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error)
 	DescribeTasksMock              func(ctx context.Context, params *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error)
 	DescribeTaskDefinitionMock     func(ctx context.Context, params *ecs.DescribeTaskDefinitionInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error)
 	DescribeContainerInstancesMock func(ctx context.Context, params *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error)
 	ExecuteCommandMock             func(ctx context.Context, params *ecs.ExecuteCommandInput, optFns ...func(*ecs.Options)) (*ecs.ExecuteCommandOutput, error)
+	RunTaskMock                    func(ctx context.Context, params *ecs.RunTaskInput, optFns ...func(*ecs.Options)) (*ecs.RunTaskOutput, error)
+	StopTaskMock                   func(ctx context.Context, params *ecs.StopTaskInput, optFns ...func(*ecs.Options)) (*ecs.StopTaskOutput, error)
 }
 
 func (m ECSClientMock) ListClusters(ctx context.Context, params *ecs.ListClustersInput, optFns ...func(*ecs.Options)) (*ecs.ListClustersOutput, error) {
 	return m.ListClustersMock(ctx, params, optFns...)
 }
 
+func (m ECSClientMock) DescribeClusters(ctx context.Context, params *ecs.DescribeClustersInput, optFns ...func(*ecs.Options)) (*ecs.DescribeClustersOutput, error) {
+	return m.DescribeClustersMock(ctx, params, optFns...)
+}
+
 func (m ECSClientMock) ListServices(ctx context.Context, params *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
 	return m.ListServicesMock(ctx, params, optFns...)
 }
@@ -38,6 +51,10 @@ func (m ECSClientMock) ListTasks(ctx context.Context, params *ecs.ListTasksInput
 	return m.ListTasksMock(ctx, params, optFns...)
 }
 
+func (m ECSClientMock) DescribeServices(ctx context.Context, params *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error) {
+	return m.DescribeServicesMock(ctx, params, optFns...)
+}
+
 func (m ECSClientMock) DescribeTasks(ctx context.Context, params *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
 	return m.DescribeTasksMock(ctx, params, optFns...)
 }
@@ -53,14 +70,173 @@ func (m ECSClientMock) ExecuteCommand(ctx context.Context, params *ecs.ExecuteCo
 	return m.ExecuteCommandMock(ctx, params, optFns...)
 }
 
+func (m ECSClientMock) RunTask(ctx context.Context, params *ecs.RunTaskInput, optFns ...func(*ecs.Options)) (*ecs.RunTaskOutput, error) {
+	return m.RunTaskMock(ctx, params, optFns...)
+}
+
+func (m ECSClientMock) StopTask(ctx context.Context, params *ecs.StopTaskInput, optFns ...func(*ecs.Options)) (*ecs.StopTaskOutput, error) {
+	return m.StopTaskMock(ctx, params, optFns...)
+}
+
+// ClientFactoryMock creates clients with the supplied funcs, any which aren't set return an error
+type ClientFactoryMock struct {
+	ECSMock func(profile string, region string) (ECSClient, error)
+	EC2Mock func(profile string, region string) (EC2Client, error)
+	SSMMock func(profile string, region string) (SSMClient, error)
+}
+
+func (m ClientFactoryMock) ECS(profile string, region string) (ECSClient, error) {
+	if m.ECSMock == nil {
+		return nil, errors.New("no ECS client mocked")
+	}
+	return m.ECSMock(profile, region)
+}
+
+func (m ClientFactoryMock) EC2(profile string, region string) (EC2Client, error) {
+	if m.EC2Mock == nil {
+		return nil, errors.New("no EC2 client mocked")
+	}
+	return m.EC2Mock(profile, region)
+}
+
+func (m ClientFactoryMock) SSM(profile string, region string) (SSMClient, error) {
+	if m.SSMMock == nil {
+		return nil, errors.New("no SSM client mocked")
+	}
+	return m.SSMMock(profile, region)
+}
+
+func (m ClientFactoryMock) Region(profile string, region string) (string, error) {
+	if region == "" {
+		return "eu-west-1", nil
+	}
+	return region, nil
+}
+
+// PrompterMock answers prompts with the supplied funcs. Any which aren't set choose the first option, except
+// when there is more than a page of results, where an option only found on the second page is chosen to
+// prove that pagination is working correctly.
+type PrompterMock struct {
+	SelectClusterMock   func(labels []string, clusters []ecsTypes.Cluster) (int, error)
+	SelectServiceMock   func(services []ecsTypes.Service) (string, error)
+	SelectTaskMock      func(tasks map[string]*ecsTypes.Task, requireExec bool) (*ecsTypes.Task, error)
+	SelectContainerMock func(containers []ecsTypes.Container) (*ecsTypes.Container, error)
+}
+
+func (m PrompterMock) SelectCluster(labels []string, clusters []ecsTypes.Cluster) (int, error) {
+	if m.SelectClusterMock != nil {
+		return m.SelectClusterMock(labels, clusters)
+	}
+	if len(labels) > int(*awsMaxResults) {
+		// After sorting alphabetically, the 101st cluster is at index 4
+		return 4, nil
+	}
+	return 0, nil
+}
+
+func (m PrompterMock) SelectService(services []ecsTypes.Service) (string, error) {
+	if m.SelectServiceMock != nil {
+		return m.SelectServiceMock(services)
+	}
+	if len(services) > int(*awsMaxResults) {
+		// After sorting alphabetically, the 101st service is at index 4
+		return *services[4].ServiceName, nil
+	}
+	return *services[0].ServiceName, nil
+}
+
+// describeClustersMock describes each requested cluster as an ACTIVE cluster named after its ARN
+func describeClustersMock(ctx context.Context, input *ecs.DescribeClustersInput, optFns ...func(*ecs.Options)) (*ecs.DescribeClustersOutput, error) {
+	var clusters []ecsTypes.Cluster
+	for _, arn := range input.Clusters {
+		clusters = append(clusters, ecsTypes.Cluster{
+			ClusterArn:  aws.String(arn),
+			ClusterName: aws.String(arn[strings.LastIndex(arn, "/")+1:]),
+			Status:      aws.String("ACTIVE"),
+		})
+	}
+	return &ecs.DescribeClustersOutput{Clusters: clusters}, nil
+}
+
+// describeServicesMock describes each requested service as a running service named after its ARN
+func describeServicesMock(ctx context.Context, input *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error) {
+	var services []ecsTypes.Service
+	for _, arn := range input.Services {
+		services = append(services, ecsTypes.Service{
+			ServiceArn:   aws.String(arn),
+			ServiceName:  aws.String(arn[strings.LastIndex(arn, "/")+1:]),
+			DesiredCount: 1,
+			RunningCount: 1,
+		})
+	}
+	return &ecs.DescribeServicesOutput{Services: services}, nil
+}
+
+func (m PrompterMock) SelectTask(tasks map[string]*ecsTypes.Task, requireExec bool) (*ecsTypes.Task, error) {
+	if m.SelectTaskMock != nil {
+		return m.SelectTaskMock(tasks, requireExec)
+	}
+	if len(tasks) > int(*awsMaxResults) {
+		// Task 199 is only returned in the second page of results
+		return tasks["199"], nil
+	}
+	return sortTasks(tasks)[0], nil
+}
+
+func (m PrompterMock) SelectContainer(containers []ecsTypes.Container) (*ecsTypes.Container, error) {
+	if m.SelectContainerMock != nil {
+		return m.SelectContainerMock(containers)
+	}
+	return &containers[0], nil
+}
+
+func (m PrompterMock) SelectPorts(ports []int32) ([]int32, error) {
+	return ports, nil
+}
+
+func (m PrompterMock) InputLocalPort(defaultPort string) (string, error) {
+	return "42069", nil
+}
+
+func (m PrompterMock) InputRemotePort(host string) (string, error) {
+	return "5432", nil
+}
+
+func (m PrompterMock) InputMFAToken(serial string) (string, error) {
+	return "123456", nil
+}
+
+// useTempHistory records connections made by the test to a history file in its temp dir
+func useTempHistory(t *testing.T) {
+	previous := viper.GetString("history-file")
+	viper.Set("history-file", filepath.Join(t.TempDir(), "history.json"))
+	t.Cleanup(func() { viper.Set("history-file", previous) })
+}
+
+// CommandRunnerMock runs commands with RunMock if it's set, otherwise they exit successfully without running
+type CommandRunnerMock struct {
+	RunMock func(process string, args ...string) (int, error)
+}
+
+func (m CommandRunnerMock) Run(ctx context.Context, stdin io.Reader, stdout io.Writer, stderr io.Writer, process string, args ...string) (int, error) {
+	if m.RunMock == nil {
+		return 0, nil
+	}
+	return m.RunMock(process, args...)
+}
+
 // CreateMockApp initialises a new App struct and takes a MockClient as an argument - only used in tests
 func CreateMockApp(c ECSClient) *App {
 	e := &App{
-		input:  make(chan string, 1),
-		err:    make(chan error, 1),
-		exit:   make(chan error, 1),
 		client: c,
 		region: "eu-west-1",
+		prompt: PrompterMock{},
+		runner: CommandRunnerMock{},
+		clients: ClientFactoryMock{
+			ECSMock: func(profile string, region string) (ECSClient, error) {
+				return c, nil
+			},
+		},
 	}
 
 	return e
@@ -94,6 +270,7 @@ func TestGetCluster(t *testing.T) {
 							NextToken:   aws.String("test-token"),
 						}, nil
 					},
+					DescribeClustersMock: describeClustersMock,
 				}
 			},
 			expected: "test-cluster-101",
@@ -111,6 +288,91 @@ func TestGetCluster(t *testing.T) {
 	}
 }
 
+func TestGetClusterInactive(t *testing.T) {
+	client := ECSClientMock{
+		ListClustersMock: func(ctx context.Context, input *ecs.ListClustersInput, optFns ...func(*ecs.Options)) (*ecs.ListClustersOutput, error) {
+			return &ecs.ListClustersOutput{ClusterArns: []string{
+				"arn:aws:ecs:eu-west-1:111111111111:cluster/App",
+				"arn:aws:ecs:eu-west-1:111111111111:cluster/Deleted",
+			}}, nil
+		},
+		DescribeClustersMock: func(ctx context.Context, input *ecs.DescribeClustersInput, optFns ...func(*ecs.Options)) (*ecs.DescribeClustersOutput, error) {
+			return &ecs.DescribeClustersOutput{Clusters: []ecsTypes.Cluster{
+				{ClusterName: aws.String("App"), Status: aws.String("ACTIVE"), RunningTasksCount: 3},
+				{ClusterName: aws.String("Deleted"), Status: aws.String("INACTIVE")},
+			}}, nil
+		},
+	}
+
+	cases := []struct {
+		name         string
+		showInactive bool
+		expected     []string
+	}{
+		{name: "TestGetClusterHidesInactive", expected: []string{"App"}},
+		{name: "TestGetClusterShowInactive", showInactive: true, expected: []string{"App", "Deleted"}},
+	}
+
+	for _, c := range cases {
+		viper.Set("show-inactive", c.showInactive)
+		var labels []string
+		app := CreateMockApp(client)
+		app.prompt = PrompterMock{
+			SelectClusterMock: func(l []string, clusters []ecsTypes.Cluster) (int, error) {
+				labels = l
+				assert.Equal(t, int32(3), clusters[0].RunningTasksCount)
+				return len(l) - 1, nil
+			},
+		}
+		_, err := app.getCluster()
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, labels, c.name)
+		assert.Equal(t, c.expected[len(c.expected)-1], app.cluster, c.name)
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+	viper.Set("show-inactive", false)
+}
+
+func TestGetTaskStandalone(t *testing.T) {
+	client := ECSClientMock{
+		ListTasksMock: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			assert.Nil(t, input.ServiceName)
+			return &ecs.ListTasksOutput{TaskArns: []string{
+				"arn:aws:ecs:eu-west-1:111111111111:task/App/service-task",
+				"arn:aws:ecs:eu-west-1:111111111111:task/App/scheduled-task",
+				"arn:aws:ecs:eu-west-1:111111111111:task/App/one-off-task",
+			}}, nil
+		},
+		DescribeTasksMock: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+			groups := map[string]string{
+				"service-task":   "service:api",
+				"scheduled-task": "family:report",
+				"one-off-task":   "family:migrate",
+			}
+			var tasks []ecsTypes.Task
+			for _, arn := range input.Tasks {
+				tasks = append(tasks, ecsTypes.Task{
+					TaskArn:    aws.String(arn),
+					Group:      aws.String(groups[arn[strings.LastIndex(arn, "/")+1:]]),
+					LaunchType: ecsTypes.LaunchTypeFargate,
+				})
+			}
+			return &ecs.DescribeTasksOutput{Tasks: tasks}, nil
+		},
+	}
+
+	app := CreateMockApp(client)
+	app.cluster = "App"
+	app.service = standaloneTasks
+	_, err := app.getTask()
+	assert.Nil(t, err)
+	var ids []string
+	for id := range app.tasks {
+		ids = append(ids, id)
+	}
+	assert.ElementsMatch(t, []string{"scheduled-task", "one-off-task"}, ids)
+}
+
 func TestGetService(t *testing.T) {
 	paginationCall := 1
 	cases := []struct {
@@ -130,6 +392,7 @@ func TestGetService(t *testing.T) {
 							},
 						}, nil
 					},
+					DescribeServicesMock: describeServicesMock,
 				}
 			},
 			expected: "test-service-1",
@@ -155,6 +418,7 @@ func TestGetService(t *testing.T) {
 							NextToken:   aws.String("test-token"),
 						}, nil
 					},
+					DescribeServicesMock: describeServicesMock,
 				}
 			},
 			expected: "test-service-101",
@@ -207,7 +471,7 @@ func TestGetTask(t *testing.T) {
 					DescribeTasksMock: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
 						var tasks []ecsTypes.Task
 						for _, taskArn := range input.Tasks {
-							tasks = append(tasks, ecsTypes.Task{TaskArn: &taskArn, LaunchType: ecsTypes.LaunchTypeFargate})
+							tasks = append(tasks, ecsTypes.Task{TaskArn: aws.String(taskArn), LaunchType: ecsTypes.LaunchTypeFargate})
 						}
 						return &ecs.DescribeTasksOutput{
 							Tasks: tasks,
@@ -230,7 +494,7 @@ func TestGetTask(t *testing.T) {
 						for i := paginationCall; i < (paginationCall * 100); i++ {
 							taskArn := *aws.String(fmt.Sprintf("arn:aws:ecs:eu-west-1:111111111111:task/App/%d", i))
 							taskArns = append(taskArns, taskArn)
-							tasks = append(tasks, &ecsTypes.Task{TaskArn: &taskArn, LaunchType: ecsTypes.LaunchTypeFargate})
+							tasks = append(tasks, &ecsTypes.Task{TaskArn: aws.String(taskArn), LaunchType: ecsTypes.LaunchTypeFargate})
 						}
 						paginationCall = paginationCall + 1
 						if paginationCall > 2 {
@@ -247,7 +511,7 @@ func TestGetTask(t *testing.T) {
 					DescribeTasksMock: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
 						var tasks []ecsTypes.Task
 						for _, taskArn := range input.Tasks {
-							tasks = append(tasks, ecsTypes.Task{TaskArn: &taskArn, LaunchType: ecsTypes.LaunchTypeFargate})
+							tasks = append(tasks, ecsTypes.Task{TaskArn: aws.String(taskArn), LaunchType: ecsTypes.LaunchTypeFargate})
 						}
 						return &ecs.DescribeTasksOutput{
 							Tasks: tasks,
@@ -343,3 +607,93 @@ func TestGetContainer(t *testing.T) {
 		fmt.Printf("%s PASSED\n", c.name)
 	}
 }
+
+func TestNonInteractive(t *testing.T) {
+	twoTasks := func(t *testing.T) ECSClient {
+		return ECSClientMock{
+			ListTasksMock: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+				return &ecs.ListTasksOutput{
+					TaskArns: []string{
+						*aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/8a58117dac38436ba5547e9da5d3ac3d"),
+						*aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/1f0c5d3bb1a04a5c9e3b8f6a8d2c0e7a"),
+					},
+				}, nil
+			},
+			DescribeTasksMock: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+				var tasks []ecsTypes.Task
+				for _, taskArn := range input.Tasks {
+					arn := taskArn
+					tasks = append(tasks, ecsTypes.Task{TaskArn: &arn, LaunchType: ecsTypes.LaunchTypeFargate})
+				}
+				return &ecs.DescribeTasksOutput{
+					Tasks: tasks,
+				}, nil
+			},
+		}
+	}
+	cases := []struct {
+		name     string
+		client   func(t *testing.T) ECSClient
+		run      func(e *App) error
+		expected error
+	}{
+		{
+			name:   "TestNonInteractiveAmbiguousTask",
+			client: twoTasks,
+			run: func(e *App) error {
+				_, err := e.getTask()
+				return err
+			},
+			expected: &AmbiguousTargetError{
+				Resource:   "task",
+				Candidates: []string{"1f0c5d3bb1a04a5c9e3b8f6a8d2c0e7a", "8a58117dac38436ba5547e9da5d3ac3d"},
+			},
+		},
+		{
+			name: "TestNonInteractiveAmbiguousContainer",
+			client: func(t *testing.T) ECSClient {
+				return ECSClientMock{}
+			},
+			run: func(e *App) error {
+				e.task = &ecsTypes.Task{
+					Containers: []ecsTypes.Container{
+						{Name: aws.String("echo-server")},
+						{Name: aws.String("redis")},
+					},
+				}
+				_, err := e.getContainer()
+				return err
+			},
+			expected: &AmbiguousTargetError{
+				Resource:   "container",
+				Candidates: []string{"echo-server", "redis"},
+			},
+		},
+		{
+			name: "TestNonInteractiveNoTasks",
+			client: func(t *testing.T) ECSClient {
+				return ECSClientMock{
+					ListTasksMock: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+						return &ecs.ListTasksOutput{}, nil
+					},
+				}
+			},
+			run: func(e *App) error {
+				_, err := e.getTask()
+				return err
+			},
+			expected: fmt.Errorf("no running tasks found matching the supplied flags in cluster App"),
+		},
+	}
+
+	for _, c := range cases {
+		input := CreateMockApp(c.client(t))
+		input.nonInteractive = true
+		input.cluster = "App"
+		err := c.run(input)
+		if ok := assert.Equal(t, c.expected, err); ok != true {
+			fmt.Printf("%s FAILED\n", c.name)
+		}
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+}
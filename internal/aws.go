@@ -4,75 +4,199 @@ package app
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/spf13/viper"
 )
 
 type EC2Client interface {
 	DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+	DescribeRegions(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error)
 }
 
 type ECSClient interface {
 	ListClusters(ctx context.Context, params *ecs.ListClustersInput, optFns ...func(*ecs.Options)) (*ecs.ListClustersOutput, error)
+	DescribeClusters(ctx context.Context, params *ecs.DescribeClustersInput, optFns ...func(*ecs.Options)) (*ecs.DescribeClustersOutput, error)
 	ListServices(ctx context.Context, params *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error)
 	ListTasks(ctx context.Context, params *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error)
+	DescribeServices(ctx context.Context, params *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error)
 	DescribeTasks(ctx context.Context, params *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error)
 	DescribeTaskDefinition(ctx context.Context, params *ecs.DescribeTaskDefinitionInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error)
 	DescribeContainerInstances(ctx context.Context, params *ecs.DescribeContainerInstancesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeContainerInstancesOutput, error)
 	ExecuteCommand(ctx context.Context, params *ecs.ExecuteCommandInput, optFns ...func(*ecs.Options)) (*ecs.ExecuteCommandOutput, error)
+	RunTask(ctx context.Context, params *ecs.RunTaskInput, optFns ...func(*ecs.Options)) (*ecs.RunTaskOutput, error)
+	StopTask(ctx context.Context, params *ecs.StopTaskInput, optFns ...func(*ecs.Options)) (*ecs.StopTaskOutput, error)
 }
 
-func createEcsClient() *ecs.Client {
-	region := viper.GetString("region")
-	getCustomAWSEndpoint := func(o *ecs.Options) {
-		endpointUrl := viper.GetString("aws-endpoint-url")
-		if endpointUrl != "" {
-			o.BaseEndpoint = aws.String(endpointUrl)
-		}
+type SSMClient interface {
+	StartSession(ctx context.Context, params *ssm.StartSessionInput, optFns ...func(*ssm.Options)) (*ssm.StartSessionOutput, error)
+}
+
+// ClientFactory creates the AWS service clients used by the app for a profile and region. An empty region
+// means the region configured for the profile (or environment) is used.
+type ClientFactory interface {
+	ECS(profile string, region string) (ECSClient, error)
+	EC2(profile string, region string) (EC2Client, error)
+	SSM(profile string, region string) (SSMClient, error)
+	// Region returns the region that clients for the profile and region will use
+	Region(profile string, region string) (string, error)
+}
+
+// awsClientFactory builds every client for a profile and region from a single shared config, so that
+// they use a consistent region, endpoint, retryer and credentials
+type awsClientFactory struct {
+	mu      sync.Mutex
+	configs map[[2]string]aws.Config
+	prompt  Prompter // asks for MFA codes when assuming a role
+}
+
+// NewClientFactory returns a ClientFactory which creates clients from the shared AWS config, prompting for
+// MFA codes with the Prompter
+func NewClientFactory(prompt Prompter) ClientFactory {
+	return &awsClientFactory{configs: make(map[[2]string]aws.Config), prompt: prompt}
+}
+
+// config returns the shared config for the profile and region, loading it the first time it's needed
+func (f *awsClientFactory) config(profile string, region string) (aws.Config, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := [2]string{profile, region}
+	if cfg, ok := f.configs[key]; ok {
+		return cfg, nil
 	}
-	cfg, err := config.LoadDefaultConfig(context.Background(),
-		config.WithSharedConfigProfile(viper.GetString("profile")),
-		config.WithRegion(region),
-		config.WithRetryer(func() aws.Retryer {
-			return retry.AddWithMaxBackoffDelay(retry.NewStandard(), time.Second*1)
-		}),
-	)
+	cfg, err := loadConfig(profile, region, f.prompt)
 	if err != nil {
-		panic(err)
+		return cfg, err
 	}
-	client := ecs.NewFromConfig(cfg, getCustomAWSEndpoint)
+	f.configs[key] = cfg
 
-	return client
+	return cfg, nil
 }
 
-func createEC2Client() *ec2.Client {
-	region := viper.GetString("region")
-	getCustomAWSEndpoint := func(o *ec2.Options) {
-		endpointUrl := viper.GetString("aws-endpoint-url")
-		if endpointUrl != "" {
-			o.BaseEndpoint = aws.String(endpointUrl)
-		}
+func (f *awsClientFactory) ECS(profile string, region string) (ECSClient, error) {
+	cfg, err := f.config(profile, region)
+	if err != nil {
+		return nil, err
+	}
+	return ecs.NewFromConfig(cfg, func(o *ecs.Options) {
+		o.BaseEndpoint = customEndpoint()
+	}), nil
+}
+
+func (f *awsClientFactory) EC2(profile string, region string) (EC2Client, error) {
+	cfg, err := f.config(profile, region)
+	if err != nil {
+		return nil, err
+	}
+	return ec2.NewFromConfig(cfg, func(o *ec2.Options) {
+		o.BaseEndpoint = customEndpoint()
+	}), nil
+}
+
+func (f *awsClientFactory) SSM(profile string, region string) (SSMClient, error) {
+	cfg, err := f.config(profile, region)
+	if err != nil {
+		return nil, err
+	}
+	return ssm.NewFromConfig(cfg, func(o *ssm.Options) {
+		o.BaseEndpoint = customEndpoint()
+	}), nil
+}
+
+func (f *awsClientFactory) Region(profile string, region string) (string, error) {
+	cfg, err := f.config(profile, region)
+	if err != nil {
+		return "", err
 	}
+	return cfg.Region, nil
+}
+
+// customEndpoint returns the endpoint given with --aws-endpoint-url, or nil to use the default endpoint
+func customEndpoint() *string {
+	if endpointUrl := viper.GetString("aws-endpoint-url"); endpointUrl != "" {
+		return aws.String(endpointUrl)
+	}
+	return nil
+}
+
+var (
+	// assumedRoles caches the credentials for roles assumed with --role-arn by profile, so that every client
+	// shares them and the user is only prompted for an MFA code once
+	assumedRoles   = make(map[string]aws.CredentialsProvider)
+	assumedRolesMu sync.Mutex
+	// mfaMu stops MFA prompts for different profiles being shown at the same time
+	mfaMu sync.Mutex
+)
+
+// loadConfig loads the shared config for the profile and region. If --role-arn is set the role is assumed
+// using the profile's credentials, which may themselves be for a role assumed by the profile.
+func loadConfig(profile string, region string, prompt Prompter) (aws.Config, error) {
 	cfg, err := config.LoadDefaultConfig(context.Background(),
-		config.WithSharedConfigProfile(viper.GetString("profile")),
+		config.WithSharedConfigProfile(profile),
 		config.WithRegion(region),
 		config.WithRetryer(func() aws.Retryer {
 			return retry.AddWithMaxBackoffDelay(retry.NewStandard(), time.Second*1)
 		}),
 	)
 	if err != nil {
-		panic(err)
+		return cfg, err
 	}
-	client := ec2.NewFromConfig(cfg, getCustomAWSEndpoint)
 
-	return client
+	roleArn := viper.GetString("role-arn")
+	if roleArn == "" {
+		return cfg, nil
+	}
+
+	assumedRolesMu.Lock()
+	defer assumedRolesMu.Unlock()
+	if provider, ok := assumedRoles[profile]; ok {
+		cfg.Credentials = provider
+		return cfg, nil
+	}
+
+	provider := aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleArn, assumeRoleOptions(prompt)))
+	assumedRoles[profile] = provider
+	cfg.Credentials = provider
+
+	return cfg, nil
+}
+
+// assumeRoleOptions applies the --external-id, --role-session-name and --mfa-serial options, prompting for
+// the MFA code when it's needed. The user is never prompted in non-interactive mode, so a usage error is
+// returned instead.
+func assumeRoleOptions(prompt Prompter) func(o *stscreds.AssumeRoleOptions) {
+	return func(o *stscreds.AssumeRoleOptions) {
+		if externalId := viper.GetString("external-id"); externalId != "" {
+			o.ExternalID = aws.String(externalId)
+		}
+		o.RoleSessionName = viper.GetString("role-session-name")
+		if o.RoleSessionName == "" {
+			o.RoleSessionName = fmt.Sprintf("ecsgo-%d", time.Now().Unix())
+		}
+		if serial := viper.GetString("mfa-serial"); serial != "" {
+			o.SerialNumber = aws.String(serial)
+			o.TokenProvider = func() (string, error) {
+				if viper.GetBool("non-interactive") {
+					return "", &UsageError{Err: fmt.Errorf("an MFA code for %s can't be prompted for in non-interactive mode, use credentials which don't require MFA", serial)}
+				}
+				mfaMu.Lock()
+				defer mfaMu.Unlock()
+				return prompt.InputMFAToken(serial)
+			}
+		}
+	}
 }
 
 // getPlatformFamily checks an ECS tasks properties to see if the OS can be derived from its properties, otherwise
@@ -112,18 +236,27 @@ func getContainerInstanceOS(ecsClient ECSClient, ec2Client EC2Client, cluster st
 	return operatingSystem, nil
 }
 
-func getContainerPort(client ECSClient, taskDefinitionArn string, containerName string) (*int32, error) {
+// getContainerPorts returns every container port mapped in the container's definition
+func getContainerPorts(client ECSClient, taskDefinitionArn string, containerName string) ([]int32, error) {
 	res, err := client.DescribeTaskDefinition(context.TODO(), &ecs.DescribeTaskDefinitionInput{
 		TaskDefinition: aws.String(taskDefinitionArn),
 	})
 	if err != nil {
 		return nil, err
 	}
-	var container ecsTypes.ContainerDefinition
+	var ports []int32
 	for _, c := range res.TaskDefinition.ContainerDefinitions {
 		if *c.Name == containerName {
-			container = c
+			for _, p := range c.PortMappings {
+				if p.ContainerPort != nil {
+					ports = append(ports, *p.ContainerPort)
+				}
+			}
 		}
 	}
-	return container.PortMappings[0].ContainerPort, nil
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("container %s has no port mappings in task definition %s, specify the port to forward with --port", containerName, taskDefinitionArn)
+	}
+
+	return ports, nil
 }
@@ -3,24 +3,35 @@ package app
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
 
 type EC2ClientMock struct {
 	DescribeInstancesMock func(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+	DescribeRegionsMock   func(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error)
 }
 
 func (m EC2ClientMock) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
 	return m.DescribeInstancesMock(ctx, params, optFns...)
 }
 
+func (m EC2ClientMock) DescribeRegions(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error) {
+	return m.DescribeRegionsMock(ctx, params, optFns...)
+}
+
 func TestGetPlatformFamily(t *testing.T) {
 	cases := []struct {
 		name     string
@@ -140,3 +151,150 @@ func TestGetContainerInstanceOS(t *testing.T) {
 		fmt.Printf("%s PASSED\n", c.name)
 	}
 }
+
+func TestGetContainerPorts(t *testing.T) {
+	cases := []struct {
+		name      string
+		container string
+		expected  []int32
+		err       bool
+	}{
+		{
+			name:      "TestGetContainerPortsWithMultipleMappings",
+			container: "nginx",
+			expected:  []int32{80, 443},
+		},
+		{
+			name:      "TestGetContainerPortsWithoutMappings",
+			container: "sidecar",
+			err:       true,
+		},
+	}
+
+	client := ECSClientMock{
+		DescribeTaskDefinitionMock: func(ctx context.Context, input *ecs.DescribeTaskDefinitionInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error) {
+			return &ecs.DescribeTaskDefinitionOutput{
+				TaskDefinition: &ecsTypes.TaskDefinition{
+					ContainerDefinitions: []ecsTypes.ContainerDefinition{
+						{
+							Name: aws.String("nginx"),
+							PortMappings: []ecsTypes.PortMapping{
+								{ContainerPort: aws.Int32(80)},
+								{ContainerPort: aws.Int32(443)},
+							},
+						},
+						{
+							Name: aws.String("sidecar"),
+						},
+					},
+				},
+			}, nil
+		},
+	}
+
+	for _, c := range cases {
+		res, err := getContainerPorts(client, "arn:aws:ecs:eu-west-1:111111111111:task-definition/nginx:1", c.container)
+		if ok := assert.Equal(t, c.err, err != nil); ok != true {
+			fmt.Printf("%s FAILED\n", c.name)
+		}
+		if ok := assert.Equal(t, c.expected, res); ok != true {
+			fmt.Printf("%s FAILED\n", c.name)
+		}
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+}
+
+func TestLoadConfigAssumeRole(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config")
+	os.WriteFile(configFile, []byte("[profile dev]\nregion = eu-west-1\n[profile prod]\nregion = us-east-1\n"), 0644)
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+
+	_, err := loadConfig("dev", "", PrompterMock{})
+	assert.Nil(t, err)
+	assert.NotContains(t, assumedRoles, "dev")
+
+	viper.Set("role-arn", "arn:aws:iam::111111111111:role/ecsgo")
+	defer viper.Set("role-arn", "")
+
+	// Every client for the same profile shares the assumed role's credentials
+	ecsCfg, err := loadConfig("dev", "eu-west-1", PrompterMock{})
+	assert.Nil(t, err)
+	ssmCfg, err := loadConfig("dev", "eu-west-1", PrompterMock{})
+	assert.Nil(t, err)
+	assert.True(t, ecsCfg.Credentials == ssmCfg.Credentials)
+	assert.True(t, ecsCfg.Credentials == assumedRoles["dev"])
+
+	prodCfg, err := loadConfig("prod", "", PrompterMock{})
+	assert.Nil(t, err)
+	assert.True(t, ecsCfg.Credentials != prodCfg.Credentials)
+	assert.Equal(t, "us-east-1", prodCfg.Region)
+}
+
+func TestAssumeRoleOptions(t *testing.T) {
+	var o stscreds.AssumeRoleOptions
+	assumeRoleOptions(PrompterMock{})(&o)
+	assert.Nil(t, o.ExternalID)
+	assert.Nil(t, o.SerialNumber)
+	assert.True(t, strings.HasPrefix(o.RoleSessionName, "ecsgo-"))
+
+	viper.Set("external-id", "abc123")
+	viper.Set("role-session-name", "jane")
+	viper.Set("mfa-serial", "arn:aws:iam::111111111111:mfa/jane")
+	defer viper.Set("external-id", "")
+	defer viper.Set("role-session-name", "")
+	defer viper.Set("mfa-serial", "")
+
+	o = stscreds.AssumeRoleOptions{}
+	assumeRoleOptions(PrompterMock{})(&o)
+	assert.Equal(t, "abc123", *o.ExternalID)
+	assert.Equal(t, "jane", o.RoleSessionName)
+	assert.Equal(t, "arn:aws:iam::111111111111:mfa/jane", *o.SerialNumber)
+	token, err := o.TokenProvider()
+	assert.Nil(t, err)
+	assert.Equal(t, "123456", token)
+
+	// ecsgo exec never prompts
+	viper.Set("non-interactive", true)
+	defer viper.Set("non-interactive", false)
+	_, err = o.TokenProvider()
+	assert.NotNil(t, err)
+	assert.Equal(t, ExitUsage, ExitCode(err))
+}
+
+func TestClientFactory(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config")
+	os.WriteFile(configFile, []byte("[profile dev]\nregion = ap-southeast-2\n"), 0644)
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	viper.Set("aws-endpoint-url", "http://localhost:4566")
+	defer viper.Set("aws-endpoint-url", "")
+
+	factory := NewClientFactory(PrompterMock{})
+	region, err := factory.Region("dev", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "ap-southeast-2", region)
+
+	// Every client is built with the same region and endpoint
+	ecsClient, err := factory.ECS("dev", "")
+	assert.Nil(t, err)
+	ec2Client, err := factory.EC2("dev", "")
+	assert.Nil(t, err)
+	ssmClient, err := factory.SSM("dev", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "ap-southeast-2", ecsClient.(*ecs.Client).Options().Region)
+	assert.Equal(t, "ap-southeast-2", ec2Client.(*ec2.Client).Options().Region)
+	assert.Equal(t, "ap-southeast-2", ssmClient.(*ssm.Client).Options().Region)
+	assert.Equal(t, "http://localhost:4566", *ecsClient.(*ecs.Client).Options().BaseEndpoint)
+	assert.Equal(t, "http://localhost:4566", *ec2Client.(*ec2.Client).Options().BaseEndpoint)
+	assert.Equal(t, "http://localhost:4566", *ssmClient.(*ssm.Client).Options().BaseEndpoint)
+
+	ssmClient, err = factory.SSM("dev", "eu-west-2")
+	assert.Nil(t, err)
+	assert.Equal(t, "eu-west-2", ssmClient.(*ssm.Client).Options().Region)
+
+	_, err = factory.ECS("missing", "")
+	assert.NotNil(t, err)
+}
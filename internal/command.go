@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/spf13/viper"
 )
@@ -15,16 +18,11 @@ import (
 // executeCommand takes the app state and builds an execute-command session for us
 // which is then passed to the session-manager-plugin for execution
 func (e *App) executeCommand() error {
-	var command string
-	if viper.GetString("cmd") != "" {
-		command = viper.GetString("cmd")
-	} else {
-		if strings.Contains(strings.ToLower(*e.task.PlatformFamily), "windows") {
-			command = "powershell.exe"
-		} else {
-			command = "/bin/sh"
-		}
+	if outputMode() != "" {
+		return e.captureCommand()
 	}
+
+	command := getCommand(e.task)
 	App, err := e.client.ExecuteCommand(context.TODO(), &ecs.ExecuteCommandInput{
 		Cluster:     aws.String(e.cluster),
 		Interactive: *aws.Bool(true),
@@ -34,37 +32,71 @@ func (e *App) executeCommand() error {
 	})
 
 	if err != nil {
-		e.err <- err
 		return err
 	}
+	e.recordHistory(command, nil)
+
+	// Print Cluster/Service/Task information to the console
+	if !viper.GetBool("quiet") {
+		fmt.Printf("\nCluster: %v | Service: %v | Task: %s | Cmd: %s", Cyan(e.cluster), Magenta(e.service), Green(strings.Split(*e.task.TaskArn, "/")[2]), Yellow(command))
+		fmt.Printf("\nConnecting to container %v\n", Yellow(*e.container.Name))
+	}
+
+	// Connect to the session with our task details
+	_, err = e.startSession(App.Session, e.task, e.container, os.Stdin, os.Stdout, os.Stderr)
+
+	return err
+}
+
+// getCommand returns the command to run on the container, defaulting to a shell appropriate for the OS family
+func getCommand(task *ecsTypes.Task) string {
+	if viper.GetString("cmd") != "" {
+		return viper.GetString("cmd")
+	}
+	if task.PlatformFamily != nil && strings.Contains(strings.ToLower(*task.PlatformFamily), "windows") {
+		return "powershell.exe"
+	}
+	return "/bin/sh"
+}
+
+// startSession connects to an execute-command session, either with the built-in client or by passing it to the
+// session-manager-plugin, and returns the exit code of the session
+func (e *App) startSession(session *ecsTypes.Session, task *ecsTypes.Task, container *ecsTypes.Container, stdin io.Reader, stdout io.Writer, stderr io.Writer) (int, error) {
+	if e.nativeSession {
+		return runNativeSession(session, stdin, stdout, stderr)
+	}
 
-	execSess, err := json.MarshalIndent(App.Session, "", "    ")
+	args, err := e.sessionPluginArgs(session, task, container)
 	if err != nil {
-		e.err <- err
-		return err
+		return -1, err
 	}
 
-	taskArnSplit := strings.Split(*e.task.TaskArn, "/")
+	return e.runner.Run(context.Background(), stdin, stdout, stderr, "session-manager-plugin", args...)
+}
+
+// sessionTarget returns the SSM target identifying the container within the task
+func (e *App) sessionTarget(task *ecsTypes.Task, container *ecsTypes.Container) string {
+	taskArnSplit := strings.Split(*task.TaskArn, "/")
 	taskID := taskArnSplit[len(taskArnSplit)-1]
-	target := ssm.StartSessionInput{
-		Target: aws.String(fmt.Sprintf("ecs:%s_%s_%s", e.cluster, taskID, *e.container.RuntimeId)),
-	}
 
-	targetJson, err := json.MarshalIndent(target, "", "    ")
+	return fmt.Sprintf("ecs:%s_%s_%s", e.cluster, taskID, *container.RuntimeId)
+}
+
+// sessionPluginArgs builds the arguments passed to the session-manager-plugin to start an execute-command session
+func (e *App) sessionPluginArgs(session *ecsTypes.Session, task *ecsTypes.Task, container *ecsTypes.Container) ([]string, error) {
+	execSess, err := json.MarshalIndent(session, "", "    ")
 	if err != nil {
-		e.err <- err
-		return err
+		return nil, err
 	}
 
-	// Print Cluster/Service/Task information to the console
-	if !viper.GetBool("quiet") {
-		fmt.Printf("\nCluster: %v | Service: %v | Task: %s | Cmd: %s", Cyan(e.cluster), Magenta(e.service), Green(strings.Split(*e.task.TaskArn, "/")[2]), Yellow(command))
-		fmt.Printf("\nConnecting to container %v\n", Yellow(*e.container.Name))
+	target := ssm.StartSessionInput{
+		Target: aws.String(e.sessionTarget(task, container)),
 	}
 
-	// Execute the session-manager-plugin with our task details
-	err = runCommand("session-manager-plugin", string(execSess), e.region, "StartSession", "", string(targetJson))
-	e.err <- err
+	targetJson, err := json.MarshalIndent(target, "", "    ")
+	if err != nil {
+		return nil, err
+	}
 
-	return err
+	return []string{string(execSess), e.region, "StartSession", "", string(targetJson)}, nil
 }
@@ -12,6 +12,7 @@ import (
 )
 
 func TestExecuteInput(t *testing.T) {
+	useTempHistory(t)
 	cases := []struct {
 		name     string
 		expected error
@@ -51,14 +52,18 @@ func TestExecuteInput(t *testing.T) {
 
 	for _, c := range cases {
 		app := &App{
-			input:    make(chan string, 1),
-			err:      make(chan error, 1),
-			exit:     make(chan error, 1),
 			client:   c.client(t),
 			region:   "eu-west-1",
 			endpoint: "ecs.eu-west-1.amazonaws.com",
 			cluster:  c.cluster,
 			task:     c.task,
+			runner: CommandRunnerMock{
+				RunMock: func(process string, args ...string) (int, error) {
+					assert.Equal(t, "session-manager-plugin", process)
+					assert.Equal(t, []string{"eu-west-1", "StartSession"}, args[1:3])
+					return 0, nil
+				},
+			},
 		}
 		app.container = &c.task.Containers[0]
 		err := app.executeCommand()
@@ -0,0 +1,102 @@
+/* config.go contains helpers for the user's config file and the named targets stored in it */
+
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// targetKeys are the settings which can be stored in a named target
+var targetKeys = []string{
+	"profile",
+	"role-arn",
+	"external-id",
+	"role-session-name",
+	"mfa-serial",
+	"region",
+	"cluster",
+	"service",
+	"task",
+	"desired-status",
+	"launch-type",
+	"task-def",
+	"tag",
+	"started-after",
+	"az",
+	"container",
+	"cmd",
+	"forward",
+	"local-port",
+	"remote-host",
+	"remote-port",
+	"port",
+}
+
+// ConfigDir returns the directory holding the ecsgo config file, $XDG_CONFIG_HOME/ecsgo or ~/.config/ecsgo
+func ConfigDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "ecsgo")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".config", "ecsgo")
+}
+
+// ApplyTarget loads the named target from the config file, using its values for every setting that
+// hasn't been explicitly set according to isSet or with an ECSGO_ environment variable
+func ApplyTarget(name string, isSet func(key string) bool) error {
+	targets := viper.GetStringMap("targets")
+	raw, ok := targets[strings.ToLower(name)]
+	if !ok {
+		var names []string
+		for n := range targets {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("target %s not found, no targets are defined in the config file", name)
+		}
+		return fmt.Errorf("target %s not found in the config file, available targets: %s", name, strings.Join(names, ", "))
+	}
+
+	target, ok := raw.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("target %s in the config file must be a map of settings", name)
+	}
+
+	for key, value := range target {
+		if !isTargetKey(key) {
+			return fmt.Errorf("unsupported setting %s in target %s, must be one of: %s", key, name, strings.Join(targetKeys, ", "))
+		}
+		if isSet(key) || envIsSet(key) {
+			continue
+		}
+		viper.Set(key, value)
+	}
+
+	return nil
+}
+
+// envIsSet reports whether the setting has been given as an environment variable, e.g. ECSGO_CLUSTER
+func envIsSet(key string) bool {
+	_, ok := os.LookupEnv("ECSGO_" + strings.ToUpper(strings.ReplaceAll(key, "-", "_")))
+	return ok
+}
+
+func isTargetKey(key string) bool {
+	for _, k := range targetKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyTarget(t *testing.T) {
+	viper.Set("targets", map[string]interface{}{
+		"api-prod": map[string]interface{}{
+			"profile":   "prod",
+			"cluster":   "prod-cluster",
+			"service":   "api",
+			"container": "app",
+		},
+		"broken": map[string]interface{}{
+			"clusterr": "prod-cluster",
+		},
+	})
+	defer func() {
+		for _, key := range []string{"targets", "profile", "cluster", "service", "container"} {
+			viper.Set(key, nil)
+		}
+	}()
+
+	cases := []struct {
+		name     string
+		target   string
+		explicit map[string]bool
+		env      map[string]string
+		expected map[string]string
+		err      bool
+	}{
+		{
+			name:   "TestApplyTargetWithExplicitFlags",
+			target: "api-prod",
+			explicit: map[string]bool{
+				"container": true,
+			},
+			expected: map[string]string{
+				"profile":   "prod",
+				"cluster":   "prod-cluster",
+				"service":   "api",
+				"container": "sidecar",
+			},
+		},
+		{
+			name:   "TestApplyTargetWithEnvironmentVariables",
+			target: "api-prod",
+			env: map[string]string{
+				"ECSGO_SERVICE": "worker",
+			},
+			expected: map[string]string{
+				"profile":   "prod",
+				"cluster":   "prod-cluster",
+				"service":   "",
+				"container": "app",
+			},
+		},
+		{
+			name:   "TestApplyTargetNotFound",
+			target: "api-staging",
+			err:    true,
+		},
+		{
+			name:   "TestApplyTargetUnsupportedSetting",
+			target: "broken",
+			err:    true,
+		},
+	}
+
+	for _, c := range cases {
+		viper.Set("container", "sidecar")
+		viper.Set("service", nil)
+		for key, value := range c.env {
+			t.Setenv(key, value)
+		}
+		err := ApplyTarget(c.target, func(key string) bool {
+			return c.explicit[key]
+		})
+		if ok := assert.Equal(t, c.err, err != nil); ok != true {
+			fmt.Printf("%s FAILED\n", c.name)
+		}
+		for key, value := range c.expected {
+			if ok := assert.Equal(t, value, viper.GetString(key)); ok != true {
+				fmt.Printf("%s FAILED\n", c.name)
+			}
+		}
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+}
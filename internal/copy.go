@@ -0,0 +1,548 @@
+/* copy.go contains the logic for copying files and directories to and from containers */
+
+package app
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// transferMarker prefixes the lines printed by transfer scripts which aren't data
+const transferMarker = "ecsgo:"
+
+// remotePathRegex matches container paths in the form [task[/container]]:path
+var remotePathRegex = regexp.MustCompile(`^([A-Za-z0-9_-]*)(?:/([A-Za-z0-9_.-]+))?:(.+)$`)
+
+// copyPath is the source or destination of a copy, either on the local machine or on a container
+type copyPath struct {
+	remote    bool
+	task      string
+	container string
+	path      string
+}
+
+// copyRequest is a copy between the local machine and the container selected by the app
+type copyRequest struct {
+	src copyPath
+	dst copyPath
+}
+
+// parseCopyPath parses a path given to `ecsgo cp`. Paths in the form task/container:path (where the task and
+// container are optional) are on a container, anything else (optionally prefixed with local:) is local.
+func parseCopyPath(arg string) copyPath {
+	if strings.HasPrefix(arg, "local:") {
+		return copyPath{path: strings.TrimPrefix(arg, "local:")}
+	}
+
+	m := remotePathRegex.FindStringSubmatch(arg)
+	// A single letter before the colon is a Windows drive rather than a task ID
+	if m == nil || len(m[1]) == 1 {
+		return copyPath{path: arg}
+	}
+
+	return copyPath{remote: true, task: m[1], container: m[2], path: m[3]}
+}
+
+// Copy copies a file or directory between the local machine and a container. The task and container are taken
+// from the container path if given, otherwise they're resolved from flags or prompted for as usual.
+func Copy(src, dst string) error {
+	req := &copyRequest{src: parseCopyPath(src), dst: parseCopyPath(dst)}
+	if req.src.remote == req.dst.remote {
+		return errors.New("exactly one of the source and destination must be a container path, e.g. task/container:/path")
+	}
+
+	remote := req.src
+	if req.dst.remote {
+		remote = req.dst
+	}
+	if remote.task != "" {
+		viper.Set("task", remote.task)
+	}
+	if remote.container != "" {
+		viper.Set("container", remote.container)
+	}
+	if viper.GetString("task") != "" && viper.GetString("cluster") == "" {
+		return errors.New("cluster name must be specified when specifying task")
+	}
+	viper.Set("forward", false)
+	viper.Set("all-tasks", false)
+
+	e := CreateApp()
+	e.copy = req
+
+	return e.Start()
+}
+
+// executeCopy copies the file or directory between the local machine and the selected container
+func (e *App) executeCopy() error {
+	if e.task.PlatformFamily != nil && strings.Contains(strings.ToLower(*e.task.PlatformFamily), "windows") {
+		return errors.New("copying files is only supported on Linux containers")
+	}
+
+	t := &transfer{
+		run: func(script string, stdin io.Reader, stdout io.Writer) error {
+			var stderr bytes.Buffer
+			return e.executeOnTask(e.task, *e.container.Name, "sh -c "+shellQuote(script), stdin, stdout, &stderr).err
+		},
+		tmp: fmt.Sprintf("/tmp/ecsgo-%x", newUUID()),
+	}
+	if !viper.GetBool("quiet") {
+		t.progress = os.Stderr
+		fmt.Fprintf(os.Stderr, "\nCluster: %v | Service: %v | Task: %s | Container: %v\n", Cyan(e.cluster), Magenta(e.service), Green(strings.Split(*e.task.TaskArn, "/")[2]), Yellow(*e.container.Name))
+	}
+
+	if e.copy.dst.remote {
+		return t.upload(e.copy.src.path, e.copy.dst.path)
+	}
+	return t.download(e.copy.src.path, e.copy.dst.path)
+}
+
+// transfer copies data to and from a container over a single session, running a shell script on the container
+// which reads the data base64 encoded from stdin or writes it to stdout. The data as a whole is verified against
+// a SHA-256 checksum once transferred. Directories are transferred as tar archives.
+type transfer struct {
+	run      func(script string, stdin io.Reader, stdout io.Writer) error // runs a shell script on the container
+	tmp      string                                                       // temporary file on the container used to assemble the data
+	progress io.Writer
+}
+
+// upload copies the local file or directory to the container. If the destination is an existing directory
+// then the source is copied into it.
+func (t *transfer) upload(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	var f *os.File
+	if info.IsDir() {
+		f, err = os.CreateTemp("", "ecsgo-*.tar")
+		if err == nil {
+			defer os.Remove(f.Name())
+			err = writeTar(f, src)
+		}
+	} else {
+		f, err = os.Open(src)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The checksum is needed up front, as it's part of the script which receives the data
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	sum := sha256.New()
+	size, err := io.Copy(sum, f)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	name := filepath.Base(src)
+	install := fmt.Sprintf(`mv %s "$D"; chmod %o "$D"`, t.tmp, info.Mode().Perm())
+	if info.IsDir() {
+		install = fmt.Sprintf(`mkdir -p "$D"; tar -xf %s -C "$D"`, t.tmp)
+	}
+	// Sessions are attached to a terminal, so echo is turned off to stop the data being sent straight back.
+	// The data is read up to the end marker, as the end of stdin can't be signalled.
+	script := fmt.Sprintf(`set -e; trap 'rm -f %s' EXIT; stty -echo 2>/dev/null || true; sed -n '/^%seof$/q;p' | base64 -d > %s; if [ "$(sha256sum < %s | cut -d" " -f1)" != %x ]; then echo %smismatch; exit 1; fi; D=%s; if [ -d "$D" ]; then D="$D/%s"; fi; %s; echo %sdone`,
+		t.tmp, transferMarker, t.tmp, t.tmp, sum.Sum(nil), transferMarker, shellPath(dst), shellPath(name), install, transferMarker)
+
+	stdin, w := io.Pipe()
+	sending := make(chan struct{})
+	go func() {
+		defer close(sending)
+		err := writeBase64Lines(w, f, func(sent int64) {
+			t.reportProgress(name, sent, size)
+		})
+		if err == nil {
+			_, err = fmt.Fprintf(w, "%seof\n", transferMarker)
+		}
+		w.CloseWithError(err)
+	}()
+	var stdout bytes.Buffer
+	err = t.run(script, stdin, &stdout)
+	// Stop sending if the session ended early
+	stdin.Close()
+	<-sending
+	if size == 0 {
+		t.reportProgress(name, 0, 0)
+	}
+
+	lines := scriptOutput(stdout.String())
+	switch {
+	case containsLine(lines, transferMarker+"done"):
+		return nil
+	case containsLine(lines, transferMarker+"mismatch"):
+		return errors.New("checksum of the uploaded data does not match, it may have been corrupted in transit")
+	case err != nil:
+		return fmt.Errorf("failed to upload %s: %w", src, err)
+	case len(lines) > 0:
+		return fmt.Errorf("failed to upload %s: %s", src, lines[len(lines)-1])
+	default:
+		return fmt.Errorf("failed to upload %s", src)
+	}
+}
+
+// download copies the file or directory from the container to the local machine. If the destination is an
+// existing directory then the source is copied into it.
+func (t *transfer) download(src, dst string) error {
+	script := fmt.Sprintf(`set -e; trap 'rm -f %s' EXIT; S=%s; if [ -d "$S" ]; then tar -cf %s -C "$S" .; F=%s; K=dir; elif [ -f "$S" ]; then F="$S"; K=file; else echo %smissing; exit 1; fi; echo %s$K $(wc -c < "$F") $(sha256sum < "$F" | cut -d" " -f1) $(stat -c %%a "$F" 2>/dev/null || echo 644); base64 < "$F"; echo %send`,
+		t.tmp, shellPath(src), t.tmp, t.tmp, transferMarker, transferMarker, transferMarker)
+
+	r, stdout := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := t.run(script, nil, stdout)
+		stdout.Close()
+		done <- err
+	}()
+	err := t.receive(r, src, dst)
+	// Wait for the session to end, discarding anything left if the data couldn't be received
+	io.Copy(io.Discard, r)
+	if runErr := <-done; err == nil && runErr != nil {
+		err = fmt.Errorf("failed to download %s: %w", src, runErr)
+	}
+
+	return err
+}
+
+// receive reads the output of the download script, writing the data to the destination once it has been
+// verified against the checksum reported by the container
+func (t *transfer) receive(r io.Reader, src, dst string) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	// The kind of file, its size, checksum and mode are reported before the data
+	var kind string
+	var stat []string
+	for kind == "" && scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == transferMarker+"missing":
+			return fmt.Errorf("%s not found on the container", src)
+		case strings.HasPrefix(line, transferMarker+"file "), strings.HasPrefix(line, transferMarker+"dir "):
+			stat = strings.Fields(strings.TrimPrefix(line, transferMarker))
+			kind, stat = stat[0], stat[1:]
+		}
+	}
+	if kind == "" {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return errors.New("no data was received from the container")
+	}
+	if len(stat) != 3 {
+		return fmt.Errorf("unexpected output from the container: %s", strings.Join(stat, " "))
+	}
+	size, err := strconv.ParseInt(stat[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("unexpected size %q reported by the container", stat[0])
+	}
+	mode, err := strconv.ParseUint(stat[2], 8, 32)
+	if err != nil {
+		mode = 0644
+	}
+
+	name := path.Base(src)
+	dest := dst
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		dest = filepath.Join(dst, name)
+	}
+
+	dir := filepath.Dir(dest)
+	if kind == "dir" {
+		dir = ""
+	}
+	f, err := os.CreateTemp(dir, ".ecsgo-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// Lines are decoded in multiples of 4 characters, so that they can be wrapped at any length
+	sum := sha256.New()
+	var received int64
+	var encoded []byte
+	var ended bool
+	for !ended && scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == transferMarker+"end" {
+			ended = true
+			continue
+		}
+		encoded = append(encoded, line...)
+		n := len(encoded) / 4 * 4
+		data := make([]byte, base64.StdEncoding.DecodedLen(n))
+		m, err := base64.StdEncoding.Decode(data, encoded[:n])
+		if err != nil {
+			return fmt.Errorf("unexpected data received from the container: %w", err)
+		}
+		encoded = append(encoded[:0], encoded[n:]...)
+
+		if _, err := f.Write(data[:m]); err != nil {
+			return err
+		}
+		sum.Write(data[:m])
+		received += int64(m)
+		if m > 0 {
+			t.reportProgress(name, received, size)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if size == 0 {
+		t.reportProgress(name, 0, 0)
+	}
+
+	if !ended || len(encoded) > 0 || received != size || hex.EncodeToString(sum.Sum(nil)) != stat[1] {
+		return fmt.Errorf("checksum of the downloaded data does not match %s on the container, it may have changed during the copy", src)
+	}
+
+	if kind == "dir" {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return extractTar(f, dest)
+	}
+	if err := f.Chmod(fs.FileMode(mode)); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), dest)
+}
+
+// writeBase64Lines writes the data from r to w base64 encoded in 76 character lines, calling sent with the
+// number of bytes sent so far after each block
+func writeBase64Lines(w io.Writer, r io.Reader, sent func(int64)) error {
+	const lineSize = 57 // encodes to 76 characters
+	buf := make([]byte, lineSize*1024)
+	var total int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		var lines bytes.Buffer
+		for i := 0; i < n; i += lineSize {
+			end := i + lineSize
+			if end > n {
+				end = n
+			}
+			lines.WriteString(base64.StdEncoding.EncodeToString(buf[i:end]))
+			lines.WriteByte('\n')
+		}
+		if _, err := w.Write(lines.Bytes()); err != nil {
+			return err
+		}
+		total += int64(n)
+		sent(total)
+	}
+}
+
+// scriptOutput returns the lines printed by a script, excluding blank lines and anything printed by the
+// session itself
+func scriptOutput(output string) []string {
+	var lines []string
+	for _, line := range strings.Split(cleanSessionOutput(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// containsLine reports whether the line was printed
+func containsLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
+
+// reportProgress prints how much of the data has been transferred
+func (t *transfer) reportProgress(name string, done int64, total int64) {
+	if t.progress == nil {
+		return
+	}
+	percent := int64(100)
+	if total > 0 {
+		percent = done * 100 / total
+	}
+	fmt.Fprintf(t.progress, "\r%s %3d%% (%s/%s)", name, percent, formatBytes(done), formatBytes(total))
+	if done >= total {
+		fmt.Fprintln(t.progress)
+	}
+}
+
+// shellPath returns a shell expression which evaluates to the path. The path is base64 encoded so that
+// it doesn't need to be quoted.
+func shellPath(p string) string {
+	return fmt.Sprintf(`"$(echo %s | base64 -d)"`, base64.StdEncoding.EncodeToString([]byte(p)))
+}
+
+// shellQuote quotes the string as a single shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// formatBytes returns a human readable size
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// writeTar writes the contents of the directory to w as a tar archive
+func writeTar(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(dir, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// extractTar extracts the tar archive into the directory, refusing to write anything outside of it
+func extractTar(r io.Reader, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(root, filepath.FromSlash(header.Name))
+		if target == root {
+			continue
+		}
+		if !withinDir(root, target) {
+			return fmt.Errorf("refusing to extract %s outside of %s", header.Name, dir)
+		}
+		// Make sure a symlink extracted earlier doesn't lead outside of the directory
+		if parent, err := filepath.EvalSymlinks(filepath.Dir(target)); err == nil && !withinDir(root, parent) {
+			return fmt.Errorf("refusing to extract %s outside of %s", header.Name, dir)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, fs.FileMode(header.Mode).Perm()|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fs.FileMode(header.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			os.Remove(target)
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// withinDir reports whether the path is the directory or inside it
+func withinDir(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
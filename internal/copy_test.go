@@ -0,0 +1,179 @@
+package app
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCopyPath(t *testing.T) {
+	cases := []struct {
+		name     string
+		arg      string
+		expected copyPath
+	}{
+		{"local", "./config.yaml", copyPath{path: "./config.yaml"}},
+		{"localPrefix", "local:config.yaml", copyPath{path: "config.yaml"}},
+		{"windowsDrive", `C:\Users\ecsgo\config.yaml`, copyPath{path: `C:\Users\ecsgo\config.yaml`}},
+		{"taskAndContainer", "0123abcd/nginx:/etc/nginx/nginx.conf", copyPath{remote: true, task: "0123abcd", container: "nginx", path: "/etc/nginx/nginx.conf"}},
+		{"taskOnly", "0123abcd:/tmp", copyPath{remote: true, task: "0123abcd", path: "/tmp"}},
+		{"pathOnly", ":/tmp", copyPath{remote: true, path: "/tmp"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, parseCopyPath(c.arg))
+			fmt.Printf("%s PASSED\n", c.name)
+		})
+	}
+}
+
+// localTransfer returns a transfer which runs its scripts with the local shell in place of a container,
+// counting the sessions opened in sessions
+func localTransfer(t *testing.T, corrupt *int, sessions *int) *transfer {
+	for _, tool := range []string{"sh", "sed", "base64", "sha256sum", "tar"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is required to emulate the container", tool)
+		}
+	}
+
+	return &transfer{
+		run: func(script string, stdin io.Reader, stdout io.Writer) error {
+			*sessions++
+			// Run the script quoted the same way as it is for a container
+			cmd := exec.Command("sh", "-c", "sh -c "+shellQuote(script))
+			if stdin != nil {
+				cmd.Stdin = &corruptReader{r: stdin, corrupt: corrupt}
+			}
+			// Output is combined as it would be in a session's terminal
+			cmd.Stdout = &corruptWriter{w: stdout, corrupt: corrupt}
+			cmd.Stderr = cmd.Stdout
+			return cmd.Run()
+		},
+		tmp: filepath.Join(t.TempDir(), "ecsgo-transfer"),
+	}
+}
+
+// corruptWriter simulates corruption in transit by flipping part of the data written while corrupt is set
+type corruptWriter struct {
+	w       io.Writer
+	corrupt *int
+}
+
+func (c *corruptWriter) Write(b []byte) (int, error) {
+	if *c.corrupt > 0 && bytes.Contains(b, []byte("A")) {
+		*c.corrupt--
+		b = bytes.Replace(b, []byte("A"), []byte("B"), 1)
+	}
+	return c.w.Write(b)
+}
+
+// corruptReader simulates corruption in transit by flipping part of the data read while corrupt is set
+type corruptReader struct {
+	r       io.Reader
+	corrupt *int
+}
+
+func (c *corruptReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	if i := bytes.IndexByte(b[:n], 'A'); *c.corrupt > 0 && i >= 0 {
+		*c.corrupt--
+		b[i] = 'B'
+	}
+	return n, err
+}
+
+func TestTransferFile(t *testing.T) {
+	var corrupt, sessions int
+	transfer := localTransfer(t, &corrupt, &sessions)
+
+	data := make([]byte, 3*1024*1024+123)
+	rand.Read(data)
+	src := filepath.Join(t.TempDir(), "data.bin")
+	assert.Nil(t, os.WriteFile(src, data, 0750))
+
+	// Upload into an existing directory on the "container"
+	remote := t.TempDir()
+	assert.Nil(t, transfer.upload(src, remote))
+	uploaded, err := os.ReadFile(filepath.Join(remote, "data.bin"))
+	assert.Nil(t, err)
+	assert.Equal(t, data, uploaded)
+	info, err := os.Stat(filepath.Join(remote, "data.bin"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+	// The data is streamed over a single session
+	assert.Equal(t, 1, sessions)
+
+	// Download to a new file
+	dst := filepath.Join(t.TempDir(), "downloaded.bin")
+	assert.Nil(t, transfer.download(filepath.Join(remote, "data.bin"), dst))
+	downloaded, err := os.ReadFile(dst)
+	assert.Nil(t, err)
+	assert.Equal(t, data, downloaded)
+	assert.Equal(t, 2, sessions)
+
+	// Data corrupted in transit fails the copy
+	corrupt = 1
+	err = transfer.download(filepath.Join(remote, "data.bin"), filepath.Join(t.TempDir(), "failed.bin"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "checksum")
+	corrupt = 1
+	err = transfer.upload(src, filepath.Join(remote, "failed.bin"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "checksum")
+	_, err = os.Stat(filepath.Join(remote, "failed.bin"))
+	assert.True(t, os.IsNotExist(err))
+
+	err = transfer.download(filepath.Join(remote, "missing.bin"), dst)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not found")
+}
+
+func TestShellQuote(t *testing.T) {
+	output, err := exec.Command("sh", "-c", "echo "+shellQuote(`it's "quoted" $HOME`)).Output()
+	assert.Nil(t, err)
+	assert.Equal(t, "it's \"quoted\" $HOME\n", string(output))
+}
+
+func TestTransferDirectory(t *testing.T) {
+	var corrupt, sessions int
+	transfer := localTransfer(t, &corrupt, &sessions)
+
+	src := filepath.Join(t.TempDir(), "site")
+	assert.Nil(t, os.MkdirAll(filepath.Join(src, "css"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(src, "index.html"), []byte("<h1>ecsgo</h1>"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(src, "css", "main.css"), []byte("h1 { color: red; }"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(src, "empty"), nil, 0644))
+
+	remote := filepath.Join(t.TempDir(), "html")
+	assert.Nil(t, transfer.upload(src, remote))
+
+	dst := t.TempDir()
+	assert.Nil(t, transfer.download(remote, dst))
+	for _, name := range []string{"index.html", filepath.Join("css", "main.css"), "empty"} {
+		expected, _ := os.ReadFile(filepath.Join(src, name))
+		actual, err := os.ReadFile(filepath.Join(dst, "html", name))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func TestExtractTarOutsideDir(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "../evil", Mode: 0644, Size: 4, Typeflag: tar.TypeReg})
+	tw.Write([]byte("evil"))
+	tw.Close()
+
+	err := extractTar(&buf, t.TempDir())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "outside of")
+}
@@ -0,0 +1,307 @@
+/* debug.go contains the logic for launching a fresh task from a service to debug, rather than using one serving traffic */
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/spf13/viper"
+)
+
+const (
+	debugStartedBy   = "ecsgo-debug"      // recorded on debug tasks, so they're easy to find with ListTasks --started-by
+	debugWaitTimeout = 10 * time.Minute   // how long to wait for a debug task to start
+	debugStopReason  = "Stopped by ecsgo" // shown as the stopped reason of debug tasks
+)
+
+// debugPollInterval is how often the debug task is described while waiting for it to start
+var debugPollInterval = 5 * time.Second
+
+// debugRequest is a debug task to be launched from the service selected by the app
+type debugRequest struct {
+	keep     bool        // leave the tasks running on exit
+	sleep    bool        // override the command of the container with `sleep infinity`
+	launched []debugTask // the tasks launched and not yet stopped
+}
+
+// debugTask is a task launched from a service to debug
+type debugTask struct {
+	client    ECSClient // the client for the profile and region the task was launched in
+	profile   string
+	region    string
+	cluster   string
+	service   string
+	arn       string
+	task      *ecsTypes.Task // set once the task is ready for ECS Exec
+	container string         // the container left idle with `sleep infinity`, if any
+}
+
+// Debug launches a new task from the selected service's current task definition and network configuration,
+// connects to it, and stops it once the session ends unless keep is set. When sleep is set the container's
+// command is replaced with `sleep infinity`, so that the task idles rather than serving traffic or running jobs.
+func Debug(keep bool, sleep bool) error {
+	viper.Set("task", "")
+	viper.Set("all-tasks", false)
+
+	e := CreateApp()
+	e.debug = &debugRequest{keep: keep, sleep: sleep}
+
+	err := e.Start()
+	if stopErr := e.stopDebugTasks(); err == nil {
+		err = stopErr
+	}
+
+	return err
+}
+
+// launchDebugTask runs a task for the selected service in place of choosing an existing one, and waits for it
+// to be ready for ECS Exec
+func (e *App) launchDebugTask() (transition, error) {
+	switch e.service {
+	case "":
+		return done, fmt.Errorf("no services found in cluster %s to launch a debug task from", e.cluster)
+	case "*", standaloneTasks:
+		fmt.Println(Red("\nA debug task can only be launched from a service, please select one\n"))
+		return back, nil
+	}
+
+	// Going back from the container picker and choosing the same service again reuses the task already launched
+	// for it rather than launching another. Otherwise the last task is no longer needed, so it's stopped.
+	if n := len(e.debug.launched); n > 0 {
+		last := e.debug.launched[n-1]
+		if last.task != nil && last.profile == e.profile && last.region == e.region && last.cluster == e.cluster && last.service == e.service {
+			return e.useDebugTask(last.task, last.container)
+		}
+		if !e.debug.keep {
+			if err := e.stopDebugTasks(); err != nil {
+				return done, err
+			}
+		}
+	}
+
+	services, err := describeServices(e.client, e.cluster, []string{e.service})
+	if err != nil {
+		return done, err
+	}
+	if len(services) == 0 {
+		return done, fmt.Errorf("service %s not found in cluster %s", e.service, e.cluster)
+	}
+	service := services[0]
+
+	var container string
+	if e.debug.sleep {
+		container, err = e.debugContainer(aws.ToString(service.TaskDefinition))
+		if err != nil {
+			return done, err
+		}
+	}
+
+	run, err := e.client.RunTask(context.TODO(), debugTaskInput(e.cluster, service, container))
+	if err != nil {
+		return done, err
+	}
+	if len(run.Tasks) == 0 {
+		if len(run.Failures) > 0 {
+			return done, fmt.Errorf("unable to launch a debug task: %s", aws.ToString(run.Failures[0].Reason))
+		}
+		return done, errors.New("unable to launch a debug task")
+	}
+	arn := aws.ToString(run.Tasks[0].TaskArn)
+	e.debug.launched = append(e.debug.launched, debugTask{client: e.client, profile: e.profile, region: e.region, cluster: e.cluster, service: e.service, arn: arn})
+	launched := &e.debug.launched[len(e.debug.launched)-1]
+	if !viper.GetBool("quiet") {
+		fmt.Printf("\nLaunched debug task %s from %s\n", Green(taskID(&run.Tasks[0])), Magenta(taskDefinitionName(&run.Tasks[0])))
+	}
+
+	// Stop waiting on Ctrl-C, so that the task is still stopped on the way out
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	task, err := e.waitForDebugTask(ctx, arn)
+	if err != nil {
+		return done, err
+	}
+	launched.task, launched.container = task, container
+
+	return e.useDebugTask(task, container)
+}
+
+// useDebugTask selects the debug task once it's ready, moving on to choosing one of its containers
+func (e *App) useDebugTask(task *ecsTypes.Task, container string) (transition, error) {
+	e.task = task
+	e.tasks = map[string]*ecsTypes.Task{taskID(task): task}
+	if err := e.getContainerOS(); err != nil {
+		return done, err
+	}
+	// Connect to the container which was left idle
+	if container != "" {
+		viper.Set("container", container)
+	}
+
+	return skip(stepContainer), nil
+}
+
+// debugContainer returns the container whose command is overridden with `sleep infinity`, either the one given
+// with --container or the first essential container in the task definition
+func (e *App) debugContainer(taskDefinition string) (string, error) {
+	if container := viper.GetString("container"); container != "" {
+		return container, nil
+	}
+
+	def, err := e.client.DescribeTaskDefinition(context.TODO(), &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(taskDefinition),
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, c := range def.TaskDefinition.ContainerDefinitions {
+		if c.Essential == nil || *c.Essential {
+			return aws.ToString(c.Name), nil
+		}
+	}
+
+	return "", fmt.Errorf("task definition %s has no essential containers", taskDefinition)
+}
+
+// debugTaskInput builds the RunTask input for a debug task, launching the service's current task definition
+// the same way as the service does and with execute command enabled. If container is given its command is
+// overridden with `sleep infinity`.
+func debugTaskInput(cluster string, service ecsTypes.Service, container string) *ecs.RunTaskInput {
+	input := &ecs.RunTaskInput{
+		Cluster:              aws.String(cluster),
+		TaskDefinition:       service.TaskDefinition,
+		NetworkConfiguration: service.NetworkConfiguration,
+		PlatformVersion:      service.PlatformVersion,
+		PlacementConstraints: service.PlacementConstraints,
+		PlacementStrategy:    service.PlacementStrategy,
+		EnableECSManagedTags: service.EnableECSManagedTags,
+		EnableExecuteCommand: true,
+		StartedBy:            aws.String(debugStartedBy),
+		Count:                aws.Int32(1),
+	}
+	// A launch type and a capacity provider strategy can't both be given
+	if len(service.CapacityProviderStrategy) > 0 {
+		input.CapacityProviderStrategy = service.CapacityProviderStrategy
+	} else {
+		input.LaunchType = service.LaunchType
+	}
+	if container != "" {
+		input.Overrides = &ecsTypes.TaskOverride{ContainerOverrides: []ecsTypes.ContainerOverride{{
+			Name:    aws.String(container),
+			Command: []string{"sleep", "infinity"},
+		}}}
+	}
+
+	return input
+}
+
+// waitForDebugTask waits for the task to be running with the ExecuteCommandAgent running in each of its
+// containers, returning an error if the task stops, the wait times out or the context is cancelled
+func (e *App) waitForDebugTask(ctx context.Context, arn string) (*ecsTypes.Task, error) {
+	ctx, cancel := context.WithTimeout(ctx, debugWaitTimeout)
+	defer cancel()
+
+	var status string
+	for {
+		describe, err := e.client.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: aws.String(e.cluster),
+			Tasks:   []string{arn},
+		})
+		if err != nil {
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return nil, ErrCancelled
+			}
+			return nil, err
+		}
+		if len(describe.Tasks) > 0 {
+			task := describe.Tasks[0]
+			if s := aws.ToString(task.LastStatus); s != status {
+				status = s
+				if !viper.GetBool("quiet") {
+					fmt.Printf("Waiting for debug task to start... %s\n", Yellow(status))
+				}
+			}
+			switch {
+			case status == "STOPPED" || status == "DEPROVISIONING":
+				return nil, fmt.Errorf("debug task %s stopped: %s", taskID(&task), aws.ToString(task.StoppedReason))
+			case status == "RUNNING" && execAgentsRunning(&task):
+				return &task, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("timed out after %s waiting for debug task to start", debugWaitTimeout)
+			}
+			return nil, ErrCancelled
+		case <-time.After(debugPollInterval):
+		}
+	}
+}
+
+// execAgentsRunning reports whether the ExecuteCommandAgent is running in every running container of the task.
+// Containers which have already exited, such as init containers, are ignored.
+func execAgentsRunning(task *ecsTypes.Task) bool {
+	var running int
+	for _, c := range task.Containers {
+		if aws.ToString(c.LastStatus) != "RUNNING" {
+			continue
+		}
+		running++
+		if !checkExecuteCommandAgent(c).passed {
+			return false
+		}
+	}
+	return running > 0
+}
+
+// stopDebugTasks stops the debug tasks launched by the app, or lists them if they're being kept. Tasks which
+// couldn't be stopped are left in the list and returned in the error.
+func (e *App) stopDebugTasks() error {
+	if e.debug == nil || len(e.debug.launched) == 0 {
+		return nil
+	}
+
+	var remaining []debugTask
+	var failed []string
+	var first error
+	for _, t := range e.debug.launched {
+		id := t.arn[strings.LastIndex(t.arn, "/")+1:]
+		if e.debug.keep {
+			fmt.Printf("\nDebug task %s is still running, stop it with `aws ecs stop-task --cluster %s --task %s`\n", Green(id), t.cluster, id)
+			remaining = append(remaining, t)
+			continue
+		}
+		_, err := t.client.StopTask(context.Background(), &ecs.StopTaskInput{
+			Cluster: aws.String(t.cluster),
+			Task:    aws.String(t.arn),
+			Reason:  aws.String(debugStopReason),
+		})
+		if err != nil {
+			remaining = append(remaining, t)
+			failed = append(failed, id)
+			if first == nil {
+				first = e.translateError(err)
+			}
+			continue
+		}
+		if !viper.GetBool("quiet") {
+			fmt.Printf("\nStopped debug task %s\n", Green(id))
+		}
+	}
+	e.debug.launched = remaining
+	if first != nil {
+		return fmt.Errorf("unable to stop debug tasks %s, stop them manually: %w", strings.Join(failed, ", "), first)
+	}
+
+	return nil
+}
@@ -0,0 +1,310 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugTaskInput(t *testing.T) {
+	network := &ecsTypes.NetworkConfiguration{AwsvpcConfiguration: &ecsTypes.AwsVpcConfiguration{
+		Subnets:        []string{"subnet-1", "subnet-2"},
+		SecurityGroups: []string{"sg-1"},
+	}}
+	cases := []struct {
+		name      string
+		service   ecsTypes.Service
+		container string
+		expected  *ecs.RunTaskInput
+	}{
+		{
+			name: "TestDebugTaskInputLaunchType",
+			service: ecsTypes.Service{
+				TaskDefinition:       aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/api:42"),
+				LaunchType:           ecsTypes.LaunchTypeFargate,
+				PlatformVersion:      aws.String("LATEST"),
+				NetworkConfiguration: network,
+			},
+			expected: &ecs.RunTaskInput{
+				Cluster:              aws.String("App"),
+				TaskDefinition:       aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/api:42"),
+				LaunchType:           ecsTypes.LaunchTypeFargate,
+				PlatformVersion:      aws.String("LATEST"),
+				NetworkConfiguration: network,
+				EnableExecuteCommand: true,
+				StartedBy:            aws.String("ecsgo-debug"),
+				Count:                aws.Int32(1),
+			},
+		},
+		{
+			name: "TestDebugTaskInputCapacityProviders",
+			service: ecsTypes.Service{
+				TaskDefinition: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/worker:3"),
+				CapacityProviderStrategy: []ecsTypes.CapacityProviderStrategyItem{
+					{CapacityProvider: aws.String("FARGATE_SPOT"), Weight: 1},
+				},
+				NetworkConfiguration: network,
+			},
+			container: "worker",
+			expected: &ecs.RunTaskInput{
+				Cluster:        aws.String("App"),
+				TaskDefinition: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/worker:3"),
+				CapacityProviderStrategy: []ecsTypes.CapacityProviderStrategyItem{
+					{CapacityProvider: aws.String("FARGATE_SPOT"), Weight: 1},
+				},
+				NetworkConfiguration: network,
+				EnableExecuteCommand: true,
+				StartedBy:            aws.String("ecsgo-debug"),
+				Count:                aws.Int32(1),
+				Overrides: &ecsTypes.TaskOverride{ContainerOverrides: []ecsTypes.ContainerOverride{{
+					Name:    aws.String("worker"),
+					Command: []string{"sleep", "infinity"},
+				}}},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, debugTaskInput("App", c.service, c.container), c.name)
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+}
+
+// debugClient returns a mock client for a cluster with an api service, whose debug task starts after
+// describing it once and then runs with the given status
+func debugClient(t *testing.T, status string, stopped *[]string) ECSClientMock {
+	var describes int
+	return ECSClientMock{
+		DescribeServicesMock: func(ctx context.Context, input *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error) {
+			return &ecs.DescribeServicesOutput{Services: []ecsTypes.Service{{
+				ServiceName:    aws.String("api"),
+				TaskDefinition: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/api:42"),
+				LaunchType:     ecsTypes.LaunchTypeFargate,
+			}}}, nil
+		},
+		DescribeTaskDefinitionMock: func(ctx context.Context, input *ecs.DescribeTaskDefinitionInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error) {
+			return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: &ecsTypes.TaskDefinition{
+				ContainerDefinitions: []ecsTypes.ContainerDefinition{
+					{Name: aws.String("init"), Essential: aws.Bool(false)},
+					{Name: aws.String("api"), Essential: aws.Bool(true)},
+				},
+			}}, nil
+		},
+		RunTaskMock: func(ctx context.Context, input *ecs.RunTaskInput, optFns ...func(*ecs.Options)) (*ecs.RunTaskOutput, error) {
+			assert.True(t, input.EnableExecuteCommand)
+			assert.Equal(t, "arn:aws:ecs:eu-west-1:111111111111:task-definition/api:42", *input.TaskDefinition)
+			return &ecs.RunTaskOutput{Tasks: []ecsTypes.Task{{
+				TaskArn:           aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/debug"),
+				TaskDefinitionArn: input.TaskDefinition,
+			}}}, nil
+		},
+		DescribeTasksMock: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+			describes++
+			task := ecsTypes.Task{
+				TaskArn:       aws.String(input.Tasks[0]),
+				LaunchType:    ecsTypes.LaunchTypeFargate,
+				LastStatus:    aws.String("PROVISIONING"),
+				StoppedReason: aws.String("Essential container in task exited"),
+				Containers: []ecsTypes.Container{
+					{Name: aws.String("init"), LastStatus: aws.String("STOPPED")},
+					{Name: aws.String("api"), LastStatus: aws.String("RUNNING"), ManagedAgents: []ecsTypes.ManagedAgent{
+						{Name: ecsTypes.ManagedAgentNameExecuteCommandAgent, LastStatus: aws.String("RUNNING")},
+					}},
+				},
+			}
+			if describes > 1 {
+				task.LastStatus = aws.String(status)
+			}
+			return &ecs.DescribeTasksOutput{Tasks: []ecsTypes.Task{task}}, nil
+		},
+		StopTaskMock: func(ctx context.Context, input *ecs.StopTaskInput, optFns ...func(*ecs.Options)) (*ecs.StopTaskOutput, error) {
+			assert.Equal(t, "Stopped by ecsgo", *input.Reason)
+			*stopped = append(*stopped, *input.Task)
+			return &ecs.StopTaskOutput{}, nil
+		},
+	}
+}
+
+func TestLaunchDebugTask(t *testing.T) {
+	interval := debugPollInterval
+	debugPollInterval = time.Millisecond
+	defer func() { debugPollInterval = interval }()
+	viper.Set("quiet", true)
+	defer viper.Set("quiet", false)
+
+	var stopped []string
+	app := CreateMockApp(debugClient(t, "RUNNING", &stopped))
+	app.debug = &debugRequest{sleep: true}
+	viper.Set("cluster", "App")
+	viper.Set("service", "api")
+	defer viper.Set("container", "")
+
+	var executed bool
+	n := app.navigator()
+	n.steps[stepExecute] = func() (transition, error) {
+		executed = true
+		return done, nil
+	}
+	assert.Nil(t, n.run(stepCluster))
+	assert.True(t, executed)
+	assert.Equal(t, "arn:aws:ecs:eu-west-1:111111111111:task/App/debug", *app.task.TaskArn)
+	// The first essential container is left idle and connected to
+	assert.Equal(t, "api", *app.container.Name)
+	assert.Len(t, app.debug.launched, 1)
+	assert.Equal(t, "arn:aws:ecs:eu-west-1:111111111111:task/App/debug", app.debug.launched[0].arn)
+
+	assert.Nil(t, app.stopDebugTasks())
+	assert.Equal(t, []string{"arn:aws:ecs:eu-west-1:111111111111:task/App/debug"}, stopped)
+	assert.Empty(t, app.debug.launched)
+}
+
+func TestLaunchDebugTaskBack(t *testing.T) {
+	interval := debugPollInterval
+	debugPollInterval = time.Millisecond
+	defer func() { debugPollInterval = interval }()
+	viper.Set("quiet", true)
+	defer viper.Set("quiet", false)
+
+	var stopped []string
+	var runs int
+	client := debugClient(t, "RUNNING", &stopped)
+	runTask := client.RunTaskMock
+	client.RunTaskMock = func(ctx context.Context, input *ecs.RunTaskInput, optFns ...func(*ecs.Options)) (*ecs.RunTaskOutput, error) {
+		runs++
+		return runTask(ctx, input, optFns...)
+	}
+
+	// Choose Back in the container picker the first time it's shown
+	var picks int
+	app := CreateMockApp(client)
+	app.prompt = PrompterMock{
+		SelectContainerMock: func(containers []ecsTypes.Container) (*ecsTypes.Container, error) {
+			picks++
+			if picks == 1 {
+				return nil, errBack
+			}
+			return &containers[1], nil
+		},
+	}
+	app.debug = &debugRequest{}
+	viper.Set("cluster", "App")
+	viper.Set("service", "api")
+	defer viper.Set("service", "")
+
+	n := app.navigator()
+	n.steps[stepExecute] = func() (transition, error) {
+		return done, nil
+	}
+	assert.Nil(t, n.run(stepCluster))
+	assert.Equal(t, 2, picks)
+	// The task launched the first time is reused rather than launching another
+	assert.Equal(t, 1, runs)
+	assert.Len(t, app.debug.launched, 1)
+	assert.Empty(t, stopped)
+
+	// Choosing a different service stops the task launched for the last one
+	app.service = "worker"
+	_, err := app.launchDebugTask()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, runs)
+	assert.Equal(t, []string{"arn:aws:ecs:eu-west-1:111111111111:task/App/debug"}, stopped)
+	assert.Len(t, app.debug.launched, 1)
+	assert.Equal(t, "worker", app.debug.launched[0].service)
+}
+
+func TestLaunchDebugTaskStopped(t *testing.T) {
+	interval := debugPollInterval
+	debugPollInterval = time.Millisecond
+	defer func() { debugPollInterval = interval }()
+	viper.Set("quiet", true)
+	defer viper.Set("quiet", false)
+
+	var stopped []string
+	app := CreateMockApp(debugClient(t, "STOPPED", &stopped))
+	app.debug = &debugRequest{}
+	app.cluster = "App"
+	app.service = "api"
+
+	_, err := app.launchDebugTask()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Essential container in task exited")
+	// The task is still stopped on the way out
+	assert.Len(t, app.debug.launched, 1)
+}
+
+func TestLaunchDebugTaskWithoutService(t *testing.T) {
+	app := CreateMockApp(ECSClientMock{})
+	app.debug = &debugRequest{}
+	app.cluster = "App"
+
+	app.service = "*"
+	move, err := app.launchDebugTask()
+	assert.Nil(t, err)
+	assert.Equal(t, back, move)
+
+	app.service = ""
+	_, err = app.launchDebugTask()
+	assert.NotNil(t, err)
+}
+
+func TestStopDebugTasks(t *testing.T) {
+	var stopped []string
+	client := ECSClientMock{
+		StopTaskMock: func(ctx context.Context, input *ecs.StopTaskInput, optFns ...func(*ecs.Options)) (*ecs.StopTaskOutput, error) {
+			if *input.Task == "arn:aws:ecs:eu-west-1:111111111111:task/App/gone" {
+				return nil, errors.New("InvalidParameterException")
+			}
+			stopped = append(stopped, *input.Task)
+			return &ecs.StopTaskOutput{}, nil
+		},
+	}
+	viper.Set("quiet", true)
+	defer viper.Set("quiet", false)
+
+	// The tasks are stopped through the client they were launched with, as the app may since have switched
+	// to another profile or region
+	app := CreateMockApp(ECSClientMock{})
+	app.cluster = "App"
+	assert.Nil(t, app.stopDebugTasks())
+
+	app.debug = &debugRequest{keep: true, launched: []debugTask{
+		{client: client, cluster: "App", arn: "arn:aws:ecs:eu-west-1:111111111111:task/App/1"},
+	}}
+	assert.Nil(t, app.stopDebugTasks())
+	assert.Empty(t, stopped)
+	assert.Len(t, app.debug.launched, 1)
+
+	app.debug.keep = false
+	app.debug.launched = append(app.debug.launched, debugTask{client: client, cluster: "App", arn: "arn:aws:ecs:eu-west-1:111111111111:task/App/gone"})
+	err := app.stopDebugTasks()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "gone")
+	// The task which couldn't be stopped is kept, so that stopping it can be tried again
+	assert.Len(t, app.debug.launched, 1)
+	assert.Equal(t, "arn:aws:ecs:eu-west-1:111111111111:task/App/gone", app.debug.launched[0].arn)
+	assert.Equal(t, []string{"arn:aws:ecs:eu-west-1:111111111111:task/App/1"}, stopped)
+}
+
+func TestDebugSessionsAreNotRecorded(t *testing.T) {
+	useTempHistory(t)
+
+	app := CreateMockApp(ECSClientMock{})
+	app.debug = &debugRequest{}
+	app.cluster = "App"
+	app.service = "api"
+	app.task = &ecsTypes.Task{TaskDefinitionArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/api:42")}
+	app.container = &ecsTypes.Container{Name: aws.String("api")}
+	app.recordHistory("/bin/sh", nil)
+
+	history, err := LoadHistory()
+	assert.Nil(t, err)
+	assert.Empty(t, history)
+}
@@ -0,0 +1,322 @@
+/* discovery.go contains the logic for discovering clusters across multiple profiles and regions */
+
+package app
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/spf13/viper"
+)
+
+// clusterSource is a profile and region to discover clusters in, and once discovered a cluster within it
+type clusterSource struct {
+	profile string
+	region  string
+	account string
+	name    string
+	details ecsTypes.Cluster // the described cluster, shown in the picker
+}
+
+// String returns the cluster in the form [profile/]region/cluster, which can be passed to --cluster
+func (c clusterSource) String() string {
+	if c.profile != "" {
+		return fmt.Sprintf("%s/%s/%s", c.profile, c.region, c.name)
+	}
+	return fmt.Sprintf("%s/%s", c.region, c.name)
+}
+
+// label returns the cluster as shown in the picker, including the account when discovering across profiles
+func (c clusterSource) label() string {
+	if c.profile != "" && c.account != "" {
+		return fmt.Sprintf("%s (%s)", c, c.account)
+	}
+	return c.String()
+}
+
+// clusterSources returns the profiles and regions to discover clusters in. Profiles are taken from --profiles,
+// and regions are either every region enabled in the account when --all-regions is set, or those listed in
+// --regions. If none of these are set only the current profile and region are used and an empty list is returned.
+func (e *App) clusterSources() ([]clusterSource, error) {
+	profiles, err := expandProfiles(listSetting("profiles"))
+	if err != nil {
+		return nil, err
+	}
+
+	var regions []string
+	if viper.GetBool("all-regions") {
+		client, err := e.clients.EC2(e.profile, e.region)
+		if err != nil {
+			return nil, err
+		}
+		res, err := client.DescribeRegions(context.TODO(), &ec2.DescribeRegionsInput{})
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range res.Regions {
+			if r.RegionName != nil {
+				regions = append(regions, *r.RegionName)
+			}
+		}
+		sort.Strings(regions)
+	} else {
+		regions = listSetting("regions")
+	}
+
+	if len(profiles) == 0 && len(regions) == 0 {
+		return nil, nil
+	}
+	if len(profiles) == 0 {
+		profiles = []string{e.profile}
+	}
+	if len(regions) == 0 {
+		// Use the region configured for each profile
+		regions = []string{""}
+	}
+
+	var sources []clusterSource
+	for _, profile := range profiles {
+		for _, region := range regions {
+			sources = append(sources, clusterSource{profile: profile, region: region})
+		}
+	}
+
+	return sources, nil
+}
+
+// getClusterFromSources lists the clusters in each profile and region concurrently and prompts the user to
+// select one, switching the app over to the profile and region of the selected cluster
+func (e *App) getClusterFromSources(sources []clusterSource) (transition, error) {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		clusters []clusterSource
+		errs     = make([]error, len(sources))
+	)
+	discoveringProfiles := len(listSetting("profiles")) > 0
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source clusterSource) {
+			defer wg.Done()
+			client, err := e.clients.ECS(source.profile, source.region)
+			var arns []string
+			if err == nil {
+				arns, err = listClusterArns(client)
+			}
+			var described []ecsTypes.Cluster
+			if err == nil {
+				described, err = describeClusters(client, arns)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			for _, d := range activeClusters(described) {
+				// Cluster ARNs are in the form arn:aws:ecs:region:account:cluster/name
+				split := strings.SplitN(aws.ToString(d.ClusterArn), ":", 6)
+				if len(split) < 6 {
+					continue
+				}
+				c := clusterSource{region: split[3], account: split[4], name: strings.TrimPrefix(split[5], "cluster/"), details: d}
+				if discoveringProfiles {
+					c.profile = source.profile
+				}
+				clusters = append(clusters, c)
+			}
+		}(i, source)
+	}
+	wg.Wait()
+
+	// Sources can fail individually, e.g. when an SSO session has expired or a region is denied by an SCP,
+	// so only give up if all of them fail
+	var failed int
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		failed++
+		if !viper.GetBool("quiet") {
+			fmt.Println(Yellow(fmt.Sprintf("Unable to list clusters in %s: %s", sources[i].describe(), err)))
+		}
+	}
+	if failed == len(sources) {
+		return done, fmt.Errorf("unable to list clusters in any profile or region: %w", errs[0])
+	}
+	if len(clusters) == 0 {
+		return done, fmt.Errorf("no clusters found in any profile or region")
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].String() < clusters[j].String()
+	})
+
+	var selected clusterSource
+	move := next(stepService)
+	if e.nonInteractive {
+		if len(clusters) > 1 {
+			var candidates []string
+			for _, c := range clusters {
+				candidates = append(candidates, c.String())
+			}
+			return done, &AmbiguousTargetError{Resource: "cluster", Candidates: candidates}
+		}
+		selected = clusters[0]
+		move = skip(stepService)
+	} else {
+		var labels []string
+		var details []ecsTypes.Cluster
+		for _, c := range clusters {
+			labels = append(labels, c.label())
+			details = append(details, c.details)
+		}
+		selection, err := e.prompt.SelectCluster(labels, details)
+		if err != nil {
+			return done, err
+		}
+		selected = clusters[selection]
+	}
+
+	profile := e.profile
+	if discoveringProfiles {
+		profile = selected.profile
+	}
+	if err := e.useClient(profile, selected.region); err != nil {
+		return done, err
+	}
+	e.cluster = selected.name
+
+	return move, nil
+}
+
+// describe returns the profile and region of the source for use in messages
+func (c clusterSource) describe() string {
+	switch {
+	case c.profile != "" && c.region != "":
+		return fmt.Sprintf("profile %s, region %s", c.profile, c.region)
+	case c.profile != "":
+		return fmt.Sprintf("profile %s", c.profile)
+	default:
+		return fmt.Sprintf("region %s", c.region)
+	}
+}
+
+// useClient switches the app over to another profile and region
+func (e *App) useClient(profile string, region string) error {
+	if profile == e.profile && region == e.region {
+		return nil
+	}
+	client, err := e.clients.ECS(profile, region)
+	if err != nil {
+		return err
+	}
+	e.profile = profile
+	e.region = region
+	e.client = client
+
+	return nil
+}
+
+// listSetting returns a setting which may be given as a list in the config file, or comma separated on the
+// command line or in an environment variable
+func listSetting(key string) []string {
+	var values []string
+	for _, v := range viper.GetStringSlice(key) {
+		for _, value := range strings.Split(v, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+
+	return values
+}
+
+// expandProfiles expands glob patterns such as prod-* into the matching profiles in the shared config file.
+// Names without any pattern characters are used as they are.
+func expandProfiles(patterns []string) ([]string, error) {
+	var available []string
+	seen := make(map[string]bool)
+	var profiles []string
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			if !seen[pattern] {
+				seen[pattern] = true
+				profiles = append(profiles, pattern)
+			}
+			continue
+		}
+
+		if available == nil {
+			var err error
+			if available, err = sharedConfigProfiles(); err != nil {
+				return nil, err
+			}
+		}
+		var matched bool
+		for _, profile := range available {
+			if ok, err := path.Match(pattern, profile); err != nil {
+				return nil, fmt.Errorf("invalid profile pattern %q: %w", pattern, err)
+			} else if ok {
+				matched = true
+				if !seen[profile] {
+					seen[profile] = true
+					profiles = append(profiles, profile)
+				}
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no profiles in %s match %q", sharedConfigFile(), pattern)
+		}
+	}
+	sort.Strings(profiles)
+
+	return profiles, nil
+}
+
+// sharedConfigFile returns the location of the shared AWS config file
+func sharedConfigFile() string {
+	if file := os.Getenv("AWS_CONFIG_FILE"); file != "" {
+		return file
+	}
+	return config.DefaultSharedConfigFilename()
+}
+
+// sharedConfigProfiles returns the name of every profile in the shared AWS config file
+func sharedConfigProfiles() ([]string, error) {
+	f, err := os.Open(filepath.Clean(sharedConfigFile()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read profiles: %w", err)
+	}
+	defer f.Close()
+
+	var profiles []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+			continue
+		}
+		section := strings.Fields(strings.Trim(line, "[]"))
+		switch {
+		case len(section) == 1 && section[0] == "default":
+			profiles = append(profiles, "default")
+		case len(section) == 2 && section[0] == "profile":
+			profiles = append(profiles, section[1])
+		}
+	}
+
+	return profiles, scanner.Err()
+}
@@ -0,0 +1,228 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// regionalClients returns a mock ECS client per profile and region listing the given clusters, and failing for
+// any without clusters. Clusters are keyed by profile/region, or by region alone for the default profile.
+func regionalClients(clusters map[string][]string, accounts map[string]string) func(profile string, region string) (ECSClient, error) {
+	return func(profile string, region string) (ECSClient, error) {
+		key := region
+		if profile != "" {
+			key = fmt.Sprintf("%s/%s", profile, region)
+			if region == "" {
+				// Emulate the region configured for the profile
+				region = "eu-west-1"
+				key = profile
+			}
+		}
+		return ECSClientMock{
+			ListClustersMock: func(ctx context.Context, input *ecs.ListClustersInput, optFns ...func(*ecs.Options)) (*ecs.ListClustersOutput, error) {
+				names, ok := clusters[key]
+				if !ok {
+					return nil, errors.New("AccessDeniedException")
+				}
+				account, ok := accounts[profile]
+				if !ok {
+					account = "111111111111"
+				}
+				var arns []string
+				for _, name := range names {
+					arns = append(arns, fmt.Sprintf("arn:aws:ecs:%s:%s:cluster/%s", region, account, name))
+				}
+				return &ecs.ListClustersOutput{ClusterArns: arns}, nil
+			},
+			DescribeClustersMock: describeClustersMock,
+		}, nil
+	}
+}
+
+func TestGetClusterAcrossRegions(t *testing.T) {
+	clusters := map[string][]string{
+		"us-east-1":      {"App", "Web"},
+		"ap-southeast-2": {"Payments"},
+	}
+	cases := []struct {
+		name           string
+		regions        []string
+		allRegions     bool
+		nonInteractive bool
+		region         string
+		cluster        string
+		err            string
+	}{
+		{name: "TestGetClusterWithRegions", regions: []string{"us-east-1", "ap-southeast-2"}, region: "ap-southeast-2", cluster: "Payments"},
+		{name: "TestGetClusterWithCommaSeparatedRegions", regions: []string{"us-east-1,ap-southeast-2"}, region: "ap-southeast-2", cluster: "Payments"},
+		{name: "TestGetClusterWithAllRegions", allRegions: true, region: "ap-southeast-2", cluster: "Payments"},
+		{name: "TestGetClusterIgnoresFailedRegion", regions: []string{"eu-west-2", "us-east-1"}, region: "us-east-1", cluster: "App"},
+		{name: "TestGetClusterAllRegionsFailed", regions: []string{"eu-west-2"}, err: "unable to list clusters in any profile or region"},
+		{name: "TestGetClusterAcrossRegionsAmbiguous", regions: []string{"us-east-1"}, nonInteractive: true, err: "us-east-1/App"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			viper.Set("regions", c.regions)
+			viper.Set("all-regions", c.allRegions)
+			viper.Set("quiet", true)
+			defer viper.Set("regions", nil)
+			defer viper.Set("all-regions", false)
+			defer viper.Set("quiet", false)
+
+			app := CreateMockApp(ECSClientMock{})
+			app.clients = ClientFactoryMock{
+				ECSMock: regionalClients(clusters, nil),
+				EC2Mock: func(profile string, region string) (EC2Client, error) {
+					return EC2ClientMock{
+						DescribeRegionsMock: func(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error) {
+							return &ec2.DescribeRegionsOutput{Regions: []ec2Types.Region{
+								{RegionName: aws.String("us-east-1")},
+								{RegionName: aws.String("ap-southeast-2")},
+								{RegionName: aws.String("eu-west-1")},
+							}}, nil
+						},
+					}, nil
+				},
+			}
+			app.nonInteractive = c.nonInteractive
+
+			move, err := app.getCluster()
+			if err != nil {
+				assert.NotEmpty(t, c.err, "unexpected error: %s", err)
+				assert.Contains(t, err.Error(), c.err)
+			} else {
+				assert.Empty(t, c.err)
+				assert.Equal(t, next(stepService), move)
+				assert.Equal(t, c.region, app.region)
+				assert.Equal(t, c.cluster, app.cluster)
+			}
+			fmt.Printf("%s PASSED\n", c.name)
+		})
+	}
+}
+
+func TestGetClusterWithRegionPrefix(t *testing.T) {
+	viper.Set("cluster", "us-east-1/App")
+	defer viper.Set("cluster", "")
+
+	var clientRegion string
+	app := CreateMockApp(ECSClientMock{})
+	app.clients = ClientFactoryMock{
+		ECSMock: func(profile string, region string) (ECSClient, error) {
+			clientRegion = region
+			return ECSClientMock{}, nil
+		},
+	}
+
+	move, err := app.getCluster()
+	assert.Nil(t, err)
+	assert.Equal(t, skip(stepService), move)
+	assert.Equal(t, "App", app.cluster)
+	assert.Equal(t, "us-east-1", app.region)
+	assert.Equal(t, "us-east-1", clientRegion)
+
+	viper.Set("cluster", "prod/ap-southeast-2/Payments")
+	move, err = app.getCluster()
+	assert.Nil(t, err)
+	assert.Equal(t, skip(stepService), move)
+	assert.Equal(t, "Payments", app.cluster)
+	assert.Equal(t, "prod", app.profile)
+	assert.Equal(t, "ap-southeast-2", app.region)
+
+	// Cluster ARNs contain a slash, but the region is taken from the ARN
+	viper.Set("cluster", "arn:aws:ecs:eu-west-1:111111111111:cluster/prod")
+	move, err = app.getCluster()
+	assert.Nil(t, err)
+	assert.Equal(t, skip(stepService), move)
+	assert.Equal(t, "prod", app.cluster)
+	assert.Equal(t, "prod", app.profile)
+	assert.Equal(t, "eu-west-1", app.region)
+	assert.Equal(t, "eu-west-1", clientRegion)
+
+	viper.Set("cluster", "arn:aws:ecs:eu-west-1:111111111111:service/prod/api")
+	_, err = app.getCluster()
+	assert.NotNil(t, err)
+}
+
+func TestGetClusterAcrossProfiles(t *testing.T) {
+	clusters := map[string][]string{
+		"prod":              {"App"},
+		"staging":           {"App"},
+		"prod/us-east-1":    {"Web"},
+		"staging/us-east-1": {},
+	}
+	accounts := map[string]string{"prod": "222222222222", "staging": "333333333333"}
+
+	configFile := filepath.Join(t.TempDir(), "config")
+	os.WriteFile(configFile, []byte("[default]\nregion = eu-west-1\n\n[profile prod]\nsso_account_id = 222222222222\n\n[profile staging]\nsso_account_id = 333333333333\n\n[sso-session corp]\nsso_region = eu-west-1\n"), 0644)
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+
+	cases := []struct {
+		name       string
+		profiles   []string
+		regions    []string
+		candidates []string
+	}{
+		{name: "TestGetClusterWithProfiles", profiles: []string{"prod", "staging"}, candidates: []string{"prod/eu-west-1/App", "staging/eu-west-1/App"}},
+		{name: "TestGetClusterWithProfileGlob", profiles: []string{"*"}, candidates: []string{"prod/eu-west-1/App", "staging/eu-west-1/App"}},
+		{name: "TestGetClusterWithProfilesAndRegions", profiles: []string{"prod,staging"}, regions: []string{"us-east-1"}, candidates: []string{"prod/us-east-1/Web"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			viper.Set("profiles", c.profiles)
+			viper.Set("regions", c.regions)
+			viper.Set("quiet", true)
+			defer viper.Set("profiles", nil)
+			defer viper.Set("regions", nil)
+			defer viper.Set("quiet", false)
+
+			app := CreateMockApp(ECSClientMock{})
+			app.clients = ClientFactoryMock{ECSMock: regionalClients(clusters, accounts)}
+			app.nonInteractive = true
+
+			move, err := app.getCluster()
+			if err != nil {
+				if len(c.candidates) == 1 {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				ambiguous, ok := err.(*AmbiguousTargetError)
+				assert.True(t, ok)
+				assert.Equal(t, c.candidates, ambiguous.Candidates)
+			} else {
+				assert.Equal(t, skip(stepService), move)
+				assert.Equal(t, c.candidates[0], fmt.Sprintf("%s/%s/%s", app.profile, app.region, app.cluster))
+			}
+			fmt.Printf("%s PASSED\n", c.name)
+		})
+	}
+
+	// The picker shows the account of each cluster
+	source := clusterSource{profile: "prod", region: "eu-west-1", account: "222222222222", name: "App"}
+	assert.Equal(t, "prod/eu-west-1/App (222222222222)", source.label())
+}
+
+func TestExpandProfiles(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config")
+	os.WriteFile(configFile, []byte("[default]\n[profile prod-eu]\n[profile prod-us]\n[profile dev]\n[sso-session corp]\n"), 0644)
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+
+	profiles, err := expandProfiles([]string{"prod-*", "dev", "prod-eu", "sandbox"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"dev", "prod-eu", "prod-us", "sandbox"}, profiles)
+
+	_, err = expandProfiles([]string{"test-*"})
+	assert.NotNil(t, err)
+}
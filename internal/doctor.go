@@ -0,0 +1,243 @@
+/* doctor.go contains the logic for diagnosing why ECS Exec isn't working for a task */
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/spf13/viper"
+)
+
+// doctorCheck is the result of a single ECS Exec pre-requisite check
+type doctorCheck struct {
+	name   string
+	passed bool
+	detail string
+	hint   string // how to fix the problem, shown when the check fails
+}
+
+// Doctor prompts for a task and checks the pre-requisites for connecting to it with ECS Exec
+func Doctor() error {
+	viper.Set("forward", false)
+	viper.Set("all-tasks", false)
+
+	e := CreateApp()
+	e.doctor = true
+
+	return e.Start()
+}
+
+// executeDoctor runs the checks against the selected task and prints the results
+func (e *App) executeDoctor() error {
+	checks, err := diagnoseTask(e.client, e.cluster, e.task)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nCluster: %v | Service: %v | Task: %s\n\n", Cyan(e.cluster), Magenta(e.service), Green(taskID(e.task)))
+	var failed int
+	for _, c := range checks {
+		if c.passed {
+			fmt.Printf("%s %s: %s\n", Green("✔"), c.name, c.detail)
+			continue
+		}
+		failed++
+		fmt.Printf("%s %s: %s\n", Red("✘"), c.name, c.detail)
+		if c.hint != "" {
+			fmt.Printf("    %s\n", Yellow(c.hint))
+		}
+	}
+	fmt.Println()
+
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+
+	return err
+}
+
+// diagnoseTask checks the task, its containers, its task definition and its cluster for the pre-requisites of
+// ECS Exec - https://docs.aws.amazon.com/AmazonECS/latest/developerguide/ecs-exec.html
+func diagnoseTask(client ECSClient, cluster string, task *ecsTypes.Task) ([]doctorCheck, error) {
+	var checks []doctorCheck
+
+	exec := doctorCheck{
+		name:   "Execute command enabled",
+		passed: task.EnableExecuteCommand,
+		detail: "the task was started with enableExecuteCommand",
+	}
+	if !exec.passed {
+		exec.detail = "the task was started without enableExecuteCommand"
+		exec.hint = "Enable it on the service with `aws ecs update-service --enable-execute-command --force-new-deployment`, or pass --enable-execute-command to run-task. Running tasks can't be changed."
+	}
+	checks = append(checks, exec)
+
+	for _, c := range task.Containers {
+		checks = append(checks, checkExecuteCommandAgent(c))
+	}
+
+	def, err := client.DescribeTaskDefinition(context.TODO(), &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: task.TaskDefinitionArn,
+	})
+	if err != nil {
+		return nil, err
+	}
+	role := doctorCheck{name: "Task role", passed: aws.ToString(def.TaskDefinition.TaskRoleArn) != ""}
+	if role.passed {
+		role.detail = aws.ToString(def.TaskDefinition.TaskRoleArn)
+	} else {
+		role.detail = fmt.Sprintf("task definition %s has no task role", taskDefinitionName(task))
+		role.hint = "Add a task role allowing ssmmessages:CreateControlChannel, ssmmessages:CreateDataChannel, ssmmessages:OpenControlChannel and ssmmessages:OpenDataChannel."
+	}
+	checks = append(checks, role)
+
+	if isFargate(task) {
+		checks = append(checks, checkPlatformVersion(task))
+	}
+
+	clusters, err := client.DescribeClusters(context.TODO(), &ecs.DescribeClustersInput{
+		Clusters: []string{cluster},
+		Include:  []ecsTypes.ClusterField{ecsTypes.ClusterFieldConfigurations},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(clusters.Clusters) == 0 {
+		return nil, fmt.Errorf("cluster %s not found", cluster)
+	}
+	checks = append(checks, checkClusterConfiguration(clusters.Clusters[0].Configuration))
+
+	return checks, nil
+}
+
+// checkExecuteCommandAgent checks that the SSM agent ECS Exec relies on is running in the container
+func checkExecuteCommandAgent(c ecsTypes.Container) doctorCheck {
+	check := doctorCheck{
+		name:   fmt.Sprintf("ExecuteCommandAgent in %s", aws.ToString(c.Name)),
+		detail: "the agent isn't present in the container",
+		hint:   "The agent is only added to containers of tasks started with execute command enabled. If it is enabled, check the container has a writable root filesystem, and that the task can reach the SSM endpoints.",
+	}
+	for _, agent := range c.ManagedAgents {
+		if agent.Name != ecsTypes.ManagedAgentNameExecuteCommandAgent {
+			continue
+		}
+		status := aws.ToString(agent.LastStatus)
+		check.passed = status == "RUNNING"
+		check.detail = fmt.Sprintf("the agent is %s", status)
+		if reason := aws.ToString(agent.Reason); reason != "" {
+			check.detail = fmt.Sprintf("%s (%s)", check.detail, reason)
+		}
+		if status == "PENDING" {
+			check.hint = "The agent is still starting, try again in a few seconds."
+		}
+	}
+	if check.passed {
+		check.hint = ""
+	}
+
+	return check
+}
+
+// checkPlatformVersion checks that a Fargate task is running on a platform version which supports ECS Exec,
+// 1.4.0 or later on Linux and any version on Windows
+func checkPlatformVersion(task *ecsTypes.Task) doctorCheck {
+	version := aws.ToString(task.PlatformVersion)
+	check := doctorCheck{
+		name:   "Fargate platform version",
+		detail: version,
+		passed: true,
+	}
+	if task.PlatformFamily != nil && strings.Contains(strings.ToLower(*task.PlatformFamily), "windows") {
+		return check
+	}
+	if compareVersions(version, "1.4.0") < 0 {
+		check.passed = false
+		check.detail = fmt.Sprintf("%s is older than 1.4.0", version)
+		check.hint = "Run the task on platform version 1.4.0 or LATEST."
+	}
+
+	return check
+}
+
+// checkClusterConfiguration reports how the cluster encrypts and logs exec sessions. These don't prevent a
+// session from starting on their own, but the task role needs extra permissions when they're configured.
+func checkClusterConfiguration(config *ecsTypes.ClusterConfiguration) doctorCheck {
+	check := doctorCheck{
+		name:   "Cluster execute command configuration",
+		passed: true,
+		detail: "default logging, no KMS key",
+	}
+	if config == nil || config.ExecuteCommandConfiguration == nil {
+		return check
+	}
+
+	exec := config.ExecuteCommandConfiguration
+	var details []string
+	logging := exec.Logging
+	if logging == "" {
+		logging = ecsTypes.ExecuteCommandLoggingDefault
+	}
+	details = append(details, fmt.Sprintf("%s logging", strings.ToLower(string(logging))))
+	if logging == ecsTypes.ExecuteCommandLoggingOverride && exec.LogConfiguration != nil {
+		if group := aws.ToString(exec.LogConfiguration.CloudWatchLogGroupName); group != "" {
+			details = append(details, fmt.Sprintf("CloudWatch log group %s", group))
+		}
+		if bucket := aws.ToString(exec.LogConfiguration.S3BucketName); bucket != "" {
+			details = append(details, fmt.Sprintf("S3 bucket %s", bucket))
+		}
+	}
+	if key := aws.ToString(exec.KmsKeyId); key != "" {
+		details = append(details, fmt.Sprintf("KMS key %s", key))
+	} else {
+		details = append(details, "no KMS key")
+	}
+	check.detail = strings.Join(details, ", ")
+	if logging == ecsTypes.ExecuteCommandLoggingOverride || exec.KmsKeyId != nil {
+		check.detail += " - the task role needs permission to use these"
+	}
+
+	return check
+}
+
+// isFargate reports whether the task runs on Fargate, either directly or through a capacity provider
+func isFargate(task *ecsTypes.Task) bool {
+	provider := aws.ToString(task.CapacityProviderName)
+	return task.LaunchType == ecsTypes.LaunchTypeFargate || provider == "FARGATE" || provider == "FARGATE_SPOT"
+}
+
+// compareVersions compares two dotted version numbers, returning -1, 0 or 1. LATEST is newer than any version.
+func compareVersions(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "LATEST" {
+		return 1
+	}
+	if b == "LATEST" {
+		return -1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnoseTask(t *testing.T) {
+	healthy := &ecsTypes.Task{
+		TaskArn:              aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/8a58117dac38436ba5547e9da5d3ac3d"),
+		TaskDefinitionArn:    aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/api:42"),
+		LaunchType:           ecsTypes.LaunchTypeFargate,
+		PlatformVersion:      aws.String("1.4.0"),
+		EnableExecuteCommand: true,
+		Containers: []ecsTypes.Container{{
+			Name: aws.String("api"),
+			ManagedAgents: []ecsTypes.ManagedAgent{
+				{Name: ecsTypes.ManagedAgentNameExecuteCommandAgent, LastStatus: aws.String("RUNNING")},
+			},
+		}},
+	}
+	broken := &ecsTypes.Task{
+		TaskArn:           aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/1"),
+		TaskDefinitionArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/worker:3"),
+		LaunchType:        ecsTypes.LaunchTypeFargate,
+		PlatformVersion:   aws.String("1.3.0"),
+		Containers: []ecsTypes.Container{
+			{Name: aws.String("worker")},
+			{
+				Name: aws.String("sidecar"),
+				ManagedAgents: []ecsTypes.ManagedAgent{
+					{Name: ecsTypes.ManagedAgentNameExecuteCommandAgent, LastStatus: aws.String("STOPPED"), Reason: aws.String("read-only filesystem")},
+				},
+			},
+		},
+	}
+
+	client := ECSClientMock{
+		DescribeTaskDefinitionMock: func(ctx context.Context, input *ecs.DescribeTaskDefinitionInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error) {
+			def := &ecsTypes.TaskDefinition{}
+			if *input.TaskDefinition == *healthy.TaskDefinitionArn {
+				def.TaskRoleArn = aws.String("arn:aws:iam::111111111111:role/api")
+			}
+			return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: def}, nil
+		},
+		DescribeClustersMock: func(ctx context.Context, input *ecs.DescribeClustersInput, optFns ...func(*ecs.Options)) (*ecs.DescribeClustersOutput, error) {
+			assert.Equal(t, []ecsTypes.ClusterField{ecsTypes.ClusterFieldConfigurations}, input.Include)
+			return &ecs.DescribeClustersOutput{Clusters: []ecsTypes.Cluster{{
+				ClusterName: aws.String("App"),
+				Configuration: &ecsTypes.ClusterConfiguration{ExecuteCommandConfiguration: &ecsTypes.ExecuteCommandConfiguration{
+					KmsKeyId: aws.String("alias/exec"),
+					Logging:  ecsTypes.ExecuteCommandLoggingOverride,
+					LogConfiguration: &ecsTypes.ExecuteCommandLogConfiguration{
+						CloudWatchLogGroupName: aws.String("/ecs/exec"),
+					},
+				}},
+			}}}, nil
+		},
+	}
+
+	cases := []struct {
+		name     string
+		task     *ecsTypes.Task
+		expected map[string]bool
+	}{
+		{
+			name: "TestDiagnoseTaskHealthy",
+			task: healthy,
+			expected: map[string]bool{
+				"Execute command enabled":               true,
+				"ExecuteCommandAgent in api":            true,
+				"Task role":                             true,
+				"Fargate platform version":              true,
+				"Cluster execute command configuration": true,
+			},
+		},
+		{
+			name: "TestDiagnoseTaskBroken",
+			task: broken,
+			expected: map[string]bool{
+				"Execute command enabled":               false,
+				"ExecuteCommandAgent in worker":         false,
+				"ExecuteCommandAgent in sidecar":        false,
+				"Task role":                             false,
+				"Fargate platform version":              false,
+				"Cluster execute command configuration": true,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		checks, err := diagnoseTask(client, "App", c.task)
+		assert.Nil(t, err)
+		results := make(map[string]bool)
+		for _, check := range checks {
+			results[check.name] = check.passed
+			if !check.passed {
+				assert.NotEmpty(t, check.hint, "%s has no hint", check.name)
+			}
+		}
+		assert.Equal(t, c.expected, results, c.name)
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+
+	checks, _ := diagnoseTask(client, "App", broken)
+	assert.Equal(t, "the agent is STOPPED (read-only filesystem)", checks[2].detail)
+	assert.Equal(t, "override logging, CloudWatch log group /ecs/exec, KMS key alias/exec - the task role needs permission to use these", checks[5].detail)
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, compareVersions("1.4.0", "1.4.0"))
+	assert.Equal(t, -1, compareVersions("1.3.0", "1.4.0"))
+	assert.Equal(t, 1, compareVersions("1.10.0", "1.4.0"))
+	assert.Equal(t, 1, compareVersions("LATEST", "1.4.0"))
+	assert.Equal(t, -1, compareVersions("1.4", "1.4.1"))
+}
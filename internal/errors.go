@@ -0,0 +1,152 @@
+/* errors.go contains the error types returned by the app */
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/smithy-go"
+)
+
+// Exit codes returned by ecsgo, so that scripts can tell the common failures apart
+const (
+	ExitError              = 1   // any error which isn't recognised
+	ExitUsage              = 2   // the flags, arguments or config file are invalid
+	ExitAmbiguousTarget    = 3   // the supplied flags match more than one resource in non-interactive mode
+	ExitAccessDenied       = 4   // the credentials aren't allowed to perform an action
+	ExitCredentialsExpired = 5   // the SSO session or temporary credentials have expired
+	ExitNotFound           = 6   // the cluster doesn't exist
+	ExitExecNotEnabled     = 7   // the task was started without execute command enabled
+	ExitTargetNotConnected = 8   // the agent in the container isn't connected to SSM
+	ExitThrottled          = 9   // AWS throttled the requests and retries were exhausted
+	ExitCancelled          = 130 // the user cancelled a prompt with Ctrl-C
+)
+
+// AmbiguousTargetError is returned in non-interactive mode when the supplied flags match more than one
+// resource and we are unable to prompt the user to choose between them
+type AmbiguousTargetError struct {
+	Resource   string
+	Candidates []string
+}
+
+func (a *AmbiguousTargetError) Error() string {
+	return fmt.Sprintf("ambiguous target: %d %ss match, specify one with --%s:\n  %s",
+		len(a.Candidates), a.Resource, a.Resource, strings.Join(a.Candidates, "\n  "))
+}
+
+// UsageError is returned when the flags, arguments or config file are invalid, before anything is run
+type UsageError struct {
+	Err error
+}
+
+func (u *UsageError) Error() string {
+	return u.Err.Error()
+}
+
+func (u *UsageError) Unwrap() error {
+	return u.Err
+}
+
+// AWSError is a recognised error from AWS, translated into a message explaining how to resolve it
+type AWSError struct {
+	Code    int    // the exit code, one of the Exit constants
+	Message string // what went wrong and how to fix it
+	Err     error  // the original error
+}
+
+func (a *AWSError) Error() string {
+	return fmt.Sprintf("%s\n  %s", a.Message, a.Err)
+}
+
+func (a *AWSError) Unwrap() error {
+	return a.Err
+}
+
+// ExitCode returns the exit code ecsgo should exit with for the error
+func ExitCode(err error) int {
+	var awsErr *AWSError
+	var ambiguous *AmbiguousTargetError
+	var usage *UsageError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &usage):
+		return ExitUsage
+	case errors.As(err, &awsErr):
+		return awsErr.Code
+	case errors.As(err, &ambiguous):
+		return ExitAmbiguousTarget
+	case errors.Is(err, ErrCancelled):
+		return ExitCancelled
+	default:
+		return ExitError
+	}
+}
+
+// translateError recognises the common reasons for failing to connect to a container, and wraps them in an
+// AWSError with an actionable message. Any other errors are returned as they are.
+func (e *App) translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var awsErr *AWSError
+	if errors.As(err, &awsErr) {
+		return err
+	}
+
+	login := "aws sso login"
+	if e.profile != "" {
+		login = fmt.Sprintf("aws sso login --profile %s", e.profile)
+	}
+
+	var tokenErr *ssocreds.InvalidTokenError
+	if errors.As(err, &tokenErr) {
+		return &AWSError{Code: ExitCredentialsExpired, Err: err,
+			Message: fmt.Sprintf("Your SSO session has expired, run `%s` and try again", login)}
+	}
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch apiErr.ErrorCode() {
+	case "AccessDeniedException", "AccessDenied", "UnauthorizedOperation":
+		return &AWSError{Code: ExitAccessDenied, Err: err,
+			Message: "Access denied, check that your credentials allow ecs:ExecuteCommand and the other ECS actions ecsgo uses, and that no SCP or permissions boundary denies them"}
+	case "ExpiredToken", "ExpiredTokenException", "UnauthorizedException":
+		return &AWSError{Code: ExitCredentialsExpired, Err: err,
+			Message: fmt.Sprintf("Your credentials have expired, refresh them (e.g. `%s`) and try again", login)}
+	case "ClusterNotFoundException":
+		return &AWSError{Code: ExitNotFound, Err: err,
+			Message: fmt.Sprintf("Cluster %s was not found, check the cluster name, profile and region (%s)", e.cluster, e.region)}
+	case "TargetNotConnectedException":
+		return &AWSError{Code: ExitTargetNotConnected, Err: err,
+			Message: "The container isn't connected to SSM, run `ecsgo doctor` against the task to find out why"}
+	case "InvalidParameterException":
+		if strings.Contains(strings.ToLower(apiErr.ErrorMessage()), "execute command") {
+			return &AWSError{Code: ExitExecNotEnabled, Err: err,
+				Message: "Execute command isn't enabled for the task, enable it on the service with `aws ecs update-service --enable-execute-command --force-new-deployment`"}
+		}
+	}
+	if isThrottle(err) {
+		return &AWSError{Code: ExitThrottled, Err: err,
+			Message: "AWS is throttling requests, wait a moment and try again, or set AWS_RETRY_MODE=adaptive and a higher AWS_MAX_ATTEMPTS to retry for longer"}
+	}
+
+	return err
+}
+
+// isThrottle reports whether AWS rejected the request because of rate limiting
+func isThrottle(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "ThrottlingException", "Throttling", "TooManyRequestsException", "RequestLimitExceeded", "ThrottledException":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslateError(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		code     int
+		contains string
+	}{
+		{name: "TestTranslateAccessDenied", err: &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized to perform: ecs:ExecuteCommand"}, code: ExitAccessDenied, contains: "ecs:ExecuteCommand"},
+		{name: "TestTranslateTargetNotConnected", err: &ecsTypes.TargetNotConnectedException{Message: aws.String("The execute command failed due to an internal error")}, code: ExitTargetNotConnected, contains: "ecsgo doctor"},
+		{name: "TestTranslateExecNotEnabled", err: &ecsTypes.InvalidParameterException{Message: aws.String("The execute command failed because execute command was not enabled when the task was run")}, code: ExitExecNotEnabled, contains: "--enable-execute-command"},
+		{name: "TestTranslateOtherInvalidParameter", err: &ecsTypes.InvalidParameterException{Message: aws.String("Invalid identifier")}, code: ExitError},
+		{name: "TestTranslateClusterNotFound", err: &ecsTypes.ClusterNotFoundException{Message: aws.String("Cluster not found.")}, code: ExitNotFound, contains: "Cluster App was not found"},
+		{name: "TestTranslateExpiredSSOSession", err: fmt.Errorf("operation error ECS: ListClusters, %w", &ssocreds.InvalidTokenError{}), code: ExitCredentialsExpired, contains: "aws sso login --profile prod"},
+		{name: "TestTranslateExpiredToken", err: &smithy.GenericAPIError{Code: "ExpiredTokenException", Message: "The security token included in the request is expired"}, code: ExitCredentialsExpired},
+		{name: "TestTranslateThrottled", err: &retry.MaxAttemptsError{Attempt: 3, Err: &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}}, code: ExitThrottled, contains: "AWS_RETRY_MODE=adaptive"},
+		{name: "TestTranslateAmbiguousTarget", err: &AmbiguousTargetError{Resource: "task", Candidates: []string{"a", "b"}}, code: ExitAmbiguousTarget},
+		{name: "TestTranslateUnknown", err: errors.New("something else"), code: ExitError},
+	}
+
+	app := CreateMockApp(ECSClientMock{})
+	app.cluster = "App"
+	app.profile = "prod"
+	for _, c := range cases {
+		err := app.translateError(c.err)
+		assert.Equal(t, c.code, ExitCode(err), c.name)
+		assert.True(t, errors.Is(err, c.err), c.name)
+		if c.contains != "" {
+			assert.Contains(t, err.Error(), c.contains, c.name)
+		}
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+
+	assert.Equal(t, 0, ExitCode(nil))
+	assert.Equal(t, ExitUsage, ExitCode(&UsageError{Err: errors.New("invalid local port")}))
+	assert.Nil(t, app.translateError(nil))
+}
@@ -0,0 +1,251 @@
+/* fanout.go contains the logic for running a command across multiple tasks in parallel */
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/spf13/viper"
+)
+
+// executeFanOut runs the command on every task in e.tasks, running at most --concurrency sessions at once.
+// Output from each session is prefixed with the task ID and a summary is printed once all sessions exit.
+func (e *App) executeFanOut() error {
+	command := viper.GetString("cmd")
+	if command == "" {
+		return errors.New("a command must be specified with --cmd when running on all tasks")
+	}
+	containerName, err := e.getFanOutContainerName()
+	if err != nil {
+		return err
+	}
+
+	concurrency := viper.GetInt("concurrency")
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var taskIds []string
+	for id := range e.tasks {
+		taskIds = append(taskIds, id)
+	}
+	sort.Strings(taskIds)
+
+	capture := outputMode() != ""
+	if !viper.GetBool("quiet") && !capture {
+		fmt.Printf("\nCluster: %v | Service: %v | Tasks: %s | Cmd: %s\n\n", Cyan(e.cluster), Magenta(e.service), Green(len(taskIds)), Yellow(command))
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		sem     = make(chan struct{}, concurrency)
+		results = make([]commandResult, len(taskIds))
+	)
+	for i, id := range taskIds {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if capture {
+				var stdout, stderr bytes.Buffer
+				results[i] = e.executeOnTask(e.tasks[id], containerName, command, nil, &stdout, &stderr)
+				results[i].Stdout = cleanSessionOutput(stdout.String())
+				results[i].Stderr = cleanSessionOutput(stderr.String())
+				return
+			}
+
+			stdout := &prefixWriter{w: os.Stdout, mu: &mu, prefix: Green(id)}
+			stderr := &prefixWriter{w: os.Stderr, mu: &mu, prefix: Red(id)}
+			results[i] = e.executeOnTask(e.tasks[id], containerName, command, nil, stdout, stderr)
+			stdout.Flush()
+			stderr.Flush()
+		}(i, id)
+	}
+	wg.Wait()
+
+	if capture {
+		if err := writeResults(results); err != nil {
+			return err
+		}
+	}
+	if !capture {
+		fmt.Println()
+		printFanOutSummary(os.Stdout, results)
+	} else if outputMode() == "text" {
+		// Keep stdout free of anything but the command output
+		printFanOutSummary(os.Stderr, results)
+	}
+
+	var failed int
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		err = fmt.Errorf("command failed on %d of %d tasks", failed, len(results))
+	}
+
+	return err
+}
+
+// getFanOutContainerName determines which container to run the command in for each task. If --container isn't
+// set and the tasks have more than one container then the user is prompted to choose one.
+func (e *App) getFanOutContainerName() (string, error) {
+	if name := viper.GetString("container"); name != "" {
+		return name, nil
+	}
+
+	for _, t := range e.tasks {
+		if len(t.Containers) > 1 {
+			if e.nonInteractive {
+				var containerNames []string
+				for _, c := range t.Containers {
+					containerNames = append(containerNames, *c.Name)
+				}
+				return "", &AmbiguousTargetError{Resource: "container", Candidates: containerNames}
+			}
+			selection, err := e.prompt.SelectContainer(t.Containers)
+			if errors.Is(err, errBack) {
+				return "", errors.New("no container selected")
+			}
+			if err != nil {
+				return "", err
+			}
+			return *selection.Name, nil
+		}
+	}
+
+	// Every task has a single container so we use whichever it is
+	return "", nil
+}
+
+// executeOnTask runs a command non-interactively on a container within the task, writing output to the supplied
+// writers. If stdin is given it's sent to the command.
+func (e *App) executeOnTask(task *ecsTypes.Task, containerName string, command string, stdin io.Reader, stdout io.Writer, stderr io.Writer) commandResult {
+	start := time.Now()
+	result := commandResult{
+		Cluster: e.cluster,
+		Service: e.service,
+		Task:    strings.Split(*task.TaskArn, "/")[2],
+		Command: command,
+	}
+
+	var container *ecsTypes.Container
+	for _, c := range task.Containers {
+		c := c
+		if containerName == "" || *c.Name == containerName {
+			container = &c
+			break
+		}
+	}
+	if container == nil {
+		result.Container = containerName
+		result.setError(fmt.Errorf("container %s not found in task", containerName))
+		return result
+	}
+	result.Container = *container.Name
+
+	res, err := e.client.ExecuteCommand(context.TODO(), &ecs.ExecuteCommandInput{
+		Cluster:     aws.String(e.cluster),
+		Interactive: *aws.Bool(true),
+		Task:        task.TaskArn,
+		Command:     aws.String(command),
+		Container:   container.Name,
+	})
+	if err != nil {
+		result.setError(err)
+		result.setDuration(time.Since(start))
+		return result
+	}
+
+	code, err := e.startSession(res.Session, task, container, stdin, stdout, stderr)
+	// The session-manager-plugin exits with its own status rather than the command's
+	if e.nativeSession && code >= 0 {
+		result.ExitCode = &code
+	}
+	result.setError(err)
+	result.setDuration(time.Since(start))
+
+	return result
+}
+
+// printFanOutSummary writes a table detailing the outcome of each task's session
+func printFanOutSummary(w io.Writer, results []commandResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TASK\tCONTAINER\tSTATUS\tEXIT CODE\tDURATION\tERROR")
+	for _, r := range results {
+		status := Green("ok")
+		errMsg := ""
+		if r.err != nil {
+			status = Red("failed")
+			errMsg = r.err.Error()
+		}
+		exitCode := "-"
+		if r.ExitCode != nil {
+			exitCode = fmt.Sprint(*r.ExitCode)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Task, r.Container, status, exitCode, r.duration.Round(time.Millisecond), errMsg)
+	}
+	tw.Flush()
+}
+
+// prefixWriter prefixes each line written to it, so that output from concurrent sessions can be told apart.
+// The mutex is shared between writers to stop lines from different sessions interleaving.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+
+	return len(b), nil
+}
+
+// Flush writes any remaining partial line
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	err := p.writeLine(append(p.buf, '\n'))
+	p.buf = nil
+
+	return err
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := fmt.Fprintf(p.w, "[%s] %s", p.prefix, line)
+
+	return err
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteFanOut(t *testing.T) {
+	var mu sync.Mutex
+	var executed []string
+	client := ECSClientMock{
+		ExecuteCommandMock: func(ctx context.Context, input *ecs.ExecuteCommandInput, optFns ...func(*ecs.Options)) (*ecs.ExecuteCommandOutput, error) {
+			mu.Lock()
+			executed = append(executed, fmt.Sprintf("%s/%s", *input.Task, *input.Container))
+			mu.Unlock()
+			return &ecs.ExecuteCommandOutput{
+				Session: &ecsTypes.Session{
+					SessionId:  aws.String("ecs-execute-command-0e86561fddf625dc1"),
+					StreamUrl:  aws.String("wss://ssmmessages.eu-west-1.amazonaws.com/v1/data-channel/ecs-execute-command-blah"),
+					TokenValue: aws.String("abc123"),
+				},
+			}, nil
+		},
+	}
+
+	app := CreateMockApp(client)
+	app.cluster = "App"
+	app.tasks = map[string]*ecsTypes.Task{}
+	for i := 0; i < 3; i++ {
+		app.tasks[fmt.Sprint(i)] = &ecsTypes.Task{
+			TaskArn: aws.String(fmt.Sprintf("arn:aws:ecs:eu-west-1:111111111111:task/App/%d", i)),
+			Containers: []ecsTypes.Container{
+				{Name: aws.String("nginx"), RuntimeId: aws.String(fmt.Sprintf("runtime-%d", i))},
+				{Name: aws.String("sidecar"), RuntimeId: aws.String(fmt.Sprintf("runtime-sidecar-%d", i))},
+			},
+		}
+	}
+
+	viper.Set("cmd", "cat /proc/meminfo")
+	viper.Set("container", "nginx")
+	viper.Set("concurrency", 2)
+	defer viper.Set("cmd", "")
+	defer viper.Set("container", "")
+
+	err := app.executeFanOut()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{
+		"arn:aws:ecs:eu-west-1:111111111111:task/App/0/nginx",
+		"arn:aws:ecs:eu-west-1:111111111111:task/App/1/nginx",
+		"arn:aws:ecs:eu-west-1:111111111111:task/App/2/nginx",
+	}, executed)
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := &prefixWriter{w: &buf, mu: &sync.Mutex{}, prefix: "abc"}
+	fmt.Fprint(w, "line one\nline ")
+	fmt.Fprint(w, "two\npartial")
+	w.Flush()
+
+	assert.Equal(t, "[abc] line one\n[abc] line two\n[abc] partial\n", buf.String())
+}
+
+func TestExecuteOnTaskNativeExitCode(t *testing.T) {
+	cases := []struct {
+		name     string
+		exitCode string
+		expected *int
+	}{
+		{"TestExecuteOnTaskNativeExitCodeReported", "2", aws.Int(2)},
+		// A session which ends without an exit code isn't reported as successful
+		{"TestExecuteOnTaskNativeExitCodeMissing", "", nil},
+	}
+
+	for _, c := range cases {
+		var received []*agentMessage
+		server := httptest.NewServer(agentStandIn(t, &received, c.exitCode))
+		app := CreateMockApp(ECSClientMock{
+			ExecuteCommandMock: func(ctx context.Context, input *ecs.ExecuteCommandInput, optFns ...func(*ecs.Options)) (*ecs.ExecuteCommandOutput, error) {
+				return &ecs.ExecuteCommandOutput{Session: &ecsTypes.Session{
+					SessionId:  aws.String("ecs-execute-command-0e86561fddf625dc1"),
+					StreamUrl:  aws.String(strings.Replace(server.URL, "http", "ws", 1)),
+					TokenValue: aws.String("abc123"),
+				}}, nil
+			},
+		})
+		app.nativeSession = true
+		task := &ecsTypes.Task{
+			TaskArn:    aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/0"),
+			Containers: []ecsTypes.Container{{Name: aws.String("nginx")}},
+		}
+
+		var stdout, stderr bytes.Buffer
+		result := app.executeOnTask(task, "nginx", "uptime", nil, &stdout, &stderr)
+		assert.Nil(t, result.err, c.name)
+		assert.Equal(t, c.expected, result.ExitCode, c.name)
+		server.Close()
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+}
@@ -0,0 +1,175 @@
+/* filter.go contains the logic for filtering the tasks offered for selection */
+
+package app
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/spf13/viper"
+)
+
+// taskFilter narrows down the tasks listed in a cluster. Filters are applied to ListTasks where it supports
+// them, and to the results of DescribeTasks otherwise.
+type taskFilter struct {
+	desiredStatus ecsTypes.DesiredStatus
+	launchType    ecsTypes.LaunchType
+	family        string
+	revision      string
+	tags          map[string]string
+	startedAfter  time.Time
+	az            string
+}
+
+// ValidateTaskFilter checks that the task filter flags are valid
+func ValidateTaskFilter() error {
+	_, err := newTaskFilter(time.Now())
+	return err
+}
+
+// newTaskFilter builds a filter from the --desired-status, --launch-type, --task-def, --tag, --started-after
+// and --az flags
+func newTaskFilter(now time.Time) (*taskFilter, error) {
+	f := &taskFilter{
+		az: viper.GetString("az"),
+	}
+
+	if status := strings.ToUpper(viper.GetString("desired-status")); status != "" {
+		f.desiredStatus = ecsTypes.DesiredStatus(status)
+		if !containsValue(f.desiredStatus.Values(), f.desiredStatus) {
+			return nil, fmt.Errorf("invalid desired status %q, must be one of %s", status, joinValues(f.desiredStatus.Values()))
+		}
+	}
+
+	if launchType := strings.ToUpper(viper.GetString("launch-type")); launchType != "" {
+		f.launchType = ecsTypes.LaunchType(launchType)
+		if !containsValue(f.launchType.Values(), f.launchType) {
+			return nil, fmt.Errorf("invalid launch type %q, must be one of %s", launchType, joinValues(f.launchType.Values()))
+		}
+	}
+
+	if taskDef := viper.GetString("task-def"); taskDef != "" {
+		// Accept a full task definition ARN as well as family[:revision]
+		taskDef = taskDef[strings.LastIndex(taskDef, "/")+1:]
+		split := strings.SplitN(taskDef, ":", 2)
+		f.family = split[0]
+		if len(split) == 2 {
+			f.revision = split[1]
+		}
+	}
+
+	for _, tag := range listSetting("tag") {
+		split := strings.SplitN(tag, "=", 2)
+		if len(split) != 2 || split[0] == "" {
+			return nil, fmt.Errorf("invalid tag filter %q, expected key=value", tag)
+		}
+		if f.tags == nil {
+			f.tags = make(map[string]string)
+		}
+		f.tags[split[0]] = split[1]
+	}
+
+	if startedAfter := viper.GetString("started-after"); startedAfter != "" {
+		// Either a duration such as 1h, or a timestamp
+		if d, err := time.ParseDuration(startedAfter); err == nil {
+			f.startedAfter = now.Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, startedAfter); err == nil {
+			f.startedAfter = t
+		} else {
+			return nil, fmt.Errorf("invalid --started-after %q, expected a duration such as 1h or an RFC3339 timestamp", startedAfter)
+		}
+	}
+
+	return f, nil
+}
+
+// apply adds the filters supported by ListTasks to the input
+func (f *taskFilter) apply(input *ecs.ListTasksInput) {
+	if f.desiredStatus != "" {
+		input.DesiredStatus = f.desiredStatus
+	}
+	if f.launchType != "" {
+		input.LaunchType = f.launchType
+	}
+	// ListTasks doesn't allow a family to be given along with a service, so it's checked on our side instead
+	if f.family != "" && input.ServiceName == nil {
+		input.Family = aws.String(f.family)
+	}
+}
+
+// include returns the additional fields DescribeTasks needs to return for the filter to be applied
+func (f *taskFilter) include() []ecsTypes.TaskField {
+	if len(f.tags) > 0 {
+		return []ecsTypes.TaskField{ecsTypes.TaskFieldTags}
+	}
+	return nil
+}
+
+// matches reports whether the described task satisfies every filter
+func (f *taskFilter) matches(task ecsTypes.Task) bool {
+	if f.family != "" || f.revision != "" {
+		family, revision := splitTaskDefinition(aws.ToString(task.TaskDefinitionArn))
+		if f.family != "" && family != f.family {
+			return false
+		}
+		if f.revision != "" && revision != f.revision {
+			return false
+		}
+	}
+	if f.az != "" && aws.ToString(task.AvailabilityZone) != f.az {
+		return false
+	}
+	if !f.startedAfter.IsZero() && (task.StartedAt == nil || task.StartedAt.Before(f.startedAfter)) {
+		return false
+	}
+	for key, value := range f.tags {
+		var found bool
+		for _, tag := range task.Tags {
+			if aws.ToString(tag.Key) == key && aws.ToString(tag.Value) == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// active reports whether any filters are set
+func (f *taskFilter) active() bool {
+	return f.desiredStatus != "" || f.launchType != "" || f.family != "" || len(f.tags) > 0 || !f.startedAfter.IsZero() || f.az != ""
+}
+
+// splitTaskDefinition returns the family and revision of a task definition ARN
+func splitTaskDefinition(arn string) (string, string) {
+	name := arn[strings.LastIndex(arn, "/")+1:]
+	split := strings.SplitN(name, ":", 2)
+	if len(split) == 2 {
+		return split[0], split[1]
+	}
+	return split[0], ""
+}
+
+func containsValue[T comparable](values []T, value T) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func joinValues[T ~string](values []T) string {
+	var s []string
+	for _, v := range values {
+		s = append(s, string(v))
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,206 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTaskFilter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		settings map[string]interface{}
+		expected *taskFilter
+		err      string
+	}{
+		{
+			name:     "TestNewTaskFilterEmpty",
+			settings: map[string]interface{}{},
+			expected: &taskFilter{},
+		},
+		{
+			name:     "TestNewTaskFilterStatusAndLaunchType",
+			settings: map[string]interface{}{"desired-status": "stopped", "launch-type": "FARGATE"},
+			expected: &taskFilter{desiredStatus: ecsTypes.DesiredStatusStopped, launchType: ecsTypes.LaunchTypeFargate},
+		},
+		{
+			name:     "TestNewTaskFilterTaskDefinitionRevision",
+			settings: map[string]interface{}{"task-def": "api:42"},
+			expected: &taskFilter{family: "api", revision: "42"},
+		},
+		{
+			name:     "TestNewTaskFilterTaskDefinitionArn",
+			settings: map[string]interface{}{"task-def": "arn:aws:ecs:eu-west-1:111111111111:task-definition/api:7"},
+			expected: &taskFilter{family: "api", revision: "7"},
+		},
+		{
+			name:     "TestNewTaskFilterTagsAndAZ",
+			settings: map[string]interface{}{"tag": []string{"team=payments,env=prod"}, "az": "eu-west-1a"},
+			expected: &taskFilter{tags: map[string]string{"team": "payments", "env": "prod"}, az: "eu-west-1a"},
+		},
+		{
+			name:     "TestNewTaskFilterStartedAfterDuration",
+			settings: map[string]interface{}{"started-after": "90m"},
+			expected: &taskFilter{startedAfter: now.Add(-90 * time.Minute)},
+		},
+		{
+			name:     "TestNewTaskFilterStartedAfterTimestamp",
+			settings: map[string]interface{}{"started-after": "2024-04-30T08:00:00Z"},
+			expected: &taskFilter{startedAfter: time.Date(2024, 4, 30, 8, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:     "TestNewTaskFilterInvalidStatus",
+			settings: map[string]interface{}{"desired-status": "DONE"},
+			err:      "invalid desired status",
+		},
+		{
+			name:     "TestNewTaskFilterInvalidLaunchType",
+			settings: map[string]interface{}{"launch-type": "LAMBDA"},
+			err:      "invalid launch type",
+		},
+		{
+			name:     "TestNewTaskFilterInvalidTag",
+			settings: map[string]interface{}{"tag": []string{"team"}},
+			err:      "invalid tag filter",
+		},
+		{
+			name:     "TestNewTaskFilterInvalidStartedAfter",
+			settings: map[string]interface{}{"started-after": "yesterday"},
+			err:      "invalid --started-after",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for key, value := range c.settings {
+				viper.Set(key, value)
+				defer viper.Set(key, nil)
+			}
+
+			filter, err := newTaskFilter(now)
+			if c.err != "" {
+				assert.NotNil(t, err)
+				assert.Contains(t, err.Error(), c.err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, c.expected, filter)
+			}
+			fmt.Printf("%s PASSED\n", c.name)
+		})
+	}
+}
+
+func TestTaskFilterApply(t *testing.T) {
+	filter := &taskFilter{desiredStatus: ecsTypes.DesiredStatusStopped, launchType: ecsTypes.LaunchTypeEc2, family: "api"}
+
+	input := &ecs.ListTasksInput{Cluster: aws.String("App")}
+	filter.apply(input)
+	assert.Equal(t, ecsTypes.DesiredStatusStopped, input.DesiredStatus)
+	assert.Equal(t, ecsTypes.LaunchTypeEc2, input.LaunchType)
+	assert.Equal(t, "api", aws.ToString(input.Family))
+
+	// ListTasks rejects a family along with a service
+	input = &ecs.ListTasksInput{Cluster: aws.String("App"), ServiceName: aws.String("api")}
+	filter.apply(input)
+	assert.Nil(t, input.Family)
+}
+
+func TestTaskFilterMatches(t *testing.T) {
+	startedAt := time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC)
+	task := ecsTypes.Task{
+		TaskDefinitionArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/api:42"),
+		AvailabilityZone:  aws.String("eu-west-1a"),
+		StartedAt:         &startedAt,
+		Tags: []ecsTypes.Tag{
+			{Key: aws.String("team"), Value: aws.String("payments")},
+			{Key: aws.String("env"), Value: aws.String("prod")},
+		},
+	}
+	cases := []struct {
+		name     string
+		filter   *taskFilter
+		expected bool
+	}{
+		{name: "TestTaskFilterMatchesEmpty", filter: &taskFilter{}, expected: true},
+		{name: "TestTaskFilterMatchesFamily", filter: &taskFilter{family: "api"}, expected: true},
+		{name: "TestTaskFilterMatchesRevision", filter: &taskFilter{family: "api", revision: "42"}, expected: true},
+		{name: "TestTaskFilterMatchesWrongRevision", filter: &taskFilter{family: "api", revision: "41"}, expected: false},
+		{name: "TestTaskFilterMatchesWrongFamily", filter: &taskFilter{family: "web"}, expected: false},
+		{name: "TestTaskFilterMatchesAZ", filter: &taskFilter{az: "eu-west-1b"}, expected: false},
+		{name: "TestTaskFilterMatchesStartedAfter", filter: &taskFilter{startedAfter: startedAt.Add(-time.Minute)}, expected: true},
+		{name: "TestTaskFilterMatchesStartedBefore", filter: &taskFilter{startedAfter: startedAt.Add(time.Minute)}, expected: false},
+		{name: "TestTaskFilterMatchesTags", filter: &taskFilter{tags: map[string]string{"team": "payments", "env": "prod"}}, expected: true},
+		{name: "TestTaskFilterMatchesWrongTag", filter: &taskFilter{tags: map[string]string{"team": "search"}}, expected: false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, c.filter.matches(task), c.name)
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+
+	// A task which hasn't started yet never matches --started-after
+	assert.False(t, (&taskFilter{startedAfter: startedAt}).matches(ecsTypes.Task{}))
+}
+
+func TestGetTaskWithFilter(t *testing.T) {
+	viper.Set("launch-type", "FARGATE")
+	viper.Set("task-def", "api:42")
+	viper.Set("tag", []string{"team=payments"})
+	defer viper.Set("launch-type", nil)
+	defer viper.Set("task-def", nil)
+	defer viper.Set("tag", nil)
+
+	var listInput *ecs.ListTasksInput
+	var describeInput *ecs.DescribeTasksInput
+	tasks := map[string]ecsTypes.Task{
+		"arn:aws:ecs:eu-west-1:111111111111:task/App/1": {
+			TaskDefinitionArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/api:41"),
+			Tags:              []ecsTypes.Tag{{Key: aws.String("team"), Value: aws.String("payments")}},
+		},
+		"arn:aws:ecs:eu-west-1:111111111111:task/App/2": {
+			TaskDefinitionArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/api:42"),
+			Tags:              []ecsTypes.Tag{{Key: aws.String("team"), Value: aws.String("payments")}},
+		},
+		"arn:aws:ecs:eu-west-1:111111111111:task/App/3": {
+			TaskDefinitionArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/api:42"),
+		},
+	}
+	app := CreateMockApp(ECSClientMock{
+		ListTasksMock: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			listInput = input
+			var arns []string
+			for arn := range tasks {
+				arns = append(arns, arn)
+			}
+			return &ecs.ListTasksOutput{TaskArns: arns}, nil
+		},
+		DescribeTasksMock: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+			describeInput = input
+			var described []ecsTypes.Task
+			for _, arn := range input.Tasks {
+				task := tasks[arn]
+				task.TaskArn = aws.String(arn)
+				task.LaunchType = ecsTypes.LaunchTypeFargate
+				described = append(described, task)
+			}
+			return &ecs.DescribeTasksOutput{Tasks: described}, nil
+		},
+	})
+	app.cluster = "App"
+	app.service = "api"
+	app.nonInteractive = true
+
+	app.getTask()
+	assert.Equal(t, ecsTypes.LaunchTypeFargate, listInput.LaunchType)
+	assert.Nil(t, listInput.Family)
+	assert.Equal(t, []ecsTypes.TaskField{ecsTypes.TaskFieldTags}, describeInput.Include)
+	assert.Equal(t, "arn:aws:ecs:eu-west-1:111111111111:task/App/2", aws.ToString(app.task.TaskArn))
+}
@@ -3,80 +3,320 @@ package app
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/spf13/viper"
 )
 
-// executeForward takes the app state and builds a port-forward session for us
-// which is then passed to the session-manager-plugin for execution
-func (e *App) executeForward() error {
-	taskArnSplit := strings.Split(*e.task.TaskArn, "/")
-	taskID := taskArnSplit[len(taskArnSplit)-1]
-	target := ssm.StartSessionInput{
-		Target: aws.String(fmt.Sprintf("ecs:%s_%s_%s", e.cluster, taskID, *e.container.RuntimeId)),
-	}
+// portForward maps a local port to a port on the container (or remote host)
+type portForward struct {
+	localPort     string
+	remotePort    string
+	freeLocalPort bool // the local port was picked for us as 0 was requested
+}
 
-	cfg, err := config.LoadDefaultConfig(context.Background(),
-		config.WithSharedConfigProfile(viper.GetString("profile")),
-		config.WithRegion(region),
-	)
+func (p portForward) String() string {
+	return fmt.Sprintf("%s->%s", p.localPort, p.remotePort)
+}
+
+// forwardInfo describes a port-forward session, printed with --output json so scripts can find the local port
+type forwardInfo struct {
+	Cluster    string `json:"cluster"`
+	Service    string `json:"service,omitempty"`
+	Task       string `json:"task"`
+	Container  string `json:"container"`
+	LocalPort  int    `json:"localPort"`
+	RemotePort int    `json:"remotePort"`
+	RemoteHost string `json:"remoteHost,omitempty"`
+}
+
+// executeForward takes the app state and builds a port-forward session for each requested port, which are
+// then passed to the session-manager-plugin for execution. If --remote-host is set the task is used as a jump
+// box to forward to the remote host rather than the container. All sessions are closed on Ctrl-C.
+func (e *App) executeForward() error {
+	client, err := e.clients.SSM(e.profile, e.region)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	client := ssm.NewFromConfig(cfg) // TODO: add region
-	ecsClient := e.client.(*ecs.Client)
-	containerPort, err := getContainerPort(ecsClient, *e.task.TaskDefinitionArn, *e.container.Name)
+
+	forwards, err := e.getPortForwards()
 	if err != nil {
-		e.err <- err
 		return err
 	}
-	localPort := viper.GetString("local-port")
-	if localPort == "" {
-		localPort, err = inputLocalPort()
+
+	remoteHost := viper.GetString("remote-host")
+	if outputMode() == "json" {
+		var info []forwardInfo
+		for _, f := range forwards {
+			localPort, _ := strconv.Atoi(f.localPort)
+			remotePort, _ := strconv.Atoi(f.remotePort)
+			info = append(info, forwardInfo{
+				Cluster:    e.cluster,
+				Service:    e.service,
+				Task:       strings.Split(*e.task.TaskArn, "/")[2],
+				Container:  *e.container.Name,
+				LocalPort:  localPort,
+				RemotePort: remotePort,
+				RemoteHost: remoteHost,
+			})
+		}
+		b, err := json.Marshal(info)
 		if err != nil {
-			e.err <- err
 			return err
 		}
+		fmt.Println(string(b))
+	} else if !viper.GetBool("quiet") {
+		// Print Cluster/Service/Task information to the console
+		fmt.Printf("\nCluster: %v | Service: %v | Task: %s", Cyan(e.cluster), Magenta(e.service), Green(strings.Split(*e.task.TaskArn, "/")[2]))
+		for _, f := range forwards {
+			if remoteHost != "" {
+				fmt.Printf("\nPort-forwarding %s -> %s:%s via container %v", f.localPort, remoteHost, f.remotePort, Yellow(*e.container.Name))
+			} else {
+				fmt.Printf("\nPort-forwarding %s:%s -> container %v", f.localPort, f.remotePort, Yellow(*e.container.Name))
+			}
+		}
+		fmt.Println()
+	}
+
+	// Cancel every session when the user hits Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT)
+	defer stop()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		recorded sync.Once
+		errs     = make([]error, len(forwards))
+	)
+	// Only record the target once a session has actually started, so failed attempts aren't saved
+	started := func() {
+		recorded.Do(func() { e.recordHistory("", forwards) })
+	}
+	for i, f := range forwards {
+		wg.Add(1)
+		go func(i int, f portForward) {
+			defer wg.Done()
+			var stdout, stderr io.Writer = os.Stdout, os.Stderr
+			if len(forwards) > 1 {
+				// Prefix the output of each session so they can be told apart
+				out := &prefixWriter{w: os.Stdout, mu: &mu, prefix: Yellow(f)}
+				errOut := &prefixWriter{w: os.Stderr, mu: &mu, prefix: Red(f)}
+				defer out.Flush()
+				defer errOut.Flush()
+				stdout, stderr = out, errOut
+			}
+			errs[i] = e.runForward(ctx, client, f, started, stdout, stderr)
+			if len(forwards) > 1 && !viper.GetBool("quiet") {
+				mu.Lock()
+				if errs[i] != nil {
+					fmt.Printf("[%s] session closed: %s\n", Red(f), errs[i])
+				} else {
+					fmt.Printf("[%s] session closed\n", Yellow(f))
+				}
+				mu.Unlock()
+			}
+		}(i, f)
+	}
+	wg.Wait()
+
+	err = nil
+	for i, forwardErr := range errs {
+		if forwardErr != nil && ctx.Err() == nil {
+			err = fmt.Errorf("port-forward %s failed: %w", forwards[i], forwardErr)
+			break
+		}
+	}
+
+	return err
+}
+
+// startForward starts a port-forward session for a single port to the target and blocks until it is closed.
+// started is called once the session has been created.
+func (e *App) startForward(ctx context.Context, client SSMClient, sessionTarget string, f portForward, started func(), stdout io.Writer, stderr io.Writer) error {
+	target := ssm.StartSessionInput{
+		Target: aws.String(sessionTarget),
 	}
-	portNumber := fmt.Sprint(*containerPort)
+
 	input := &ssm.StartSessionInput{
 		DocumentName: aws.String("AWS-StartPortForwardingSession"),
 		Parameters: map[string][]string{
-			"localPortNumber": {localPort},
-			"portNumber":      {portNumber},
+			"localPortNumber": {f.localPort},
+			"portNumber":      {f.remotePort},
 		},
-		Target: aws.String(fmt.Sprintf("ecs:%s_%s_%s", e.cluster, taskID, *e.container.RuntimeId)),
+		Target: target.Target,
+	}
+	if remoteHost := viper.GetString("remote-host"); remoteHost != "" {
+		input.DocumentName = aws.String("AWS-StartPortForwardingSessionToRemoteHost")
+		input.Parameters["host"] = []string{remoteHost}
 	}
-	sess, err := client.StartSession(context.TODO(), input)
+
+	sess, err := client.StartSession(ctx, input)
 	if err != nil {
-		e.err <- err
 		return err
 	}
+	started()
 	sessJson, err := json.Marshal(sess)
 	if err != nil {
-		e.err <- err
 		return err
 	}
 	paramsJson, err := json.Marshal(target)
 	if err != nil {
-		e.err <- err
 		return err
 	}
 
-	// Print Cluster/Service/Task information to the console
-	if !viper.GetBool("quiet") {
-		fmt.Printf("\nCluster: %v | Service: %v | Task: %s", Cyan(e.cluster), Magenta(e.service), Green(strings.Split(*e.task.TaskArn, "/")[2]))
-		fmt.Printf("\nPort-forwarding %s:%d -> container %v\n", localPort, *containerPort, Yellow(*e.container.Name))
-	}
-
 	// Execute the session-manager-plugin with our task details
-	err = runCommand("session-manager-plugin", string(sessJson), e.region, "StartSession", "", string(paramsJson))
-	e.err <- err
+	_, err = e.runner.Run(ctx, nil, stdout, stderr, "session-manager-plugin", string(sessJson), e.region, "StartSession", "", string(paramsJson))
+
 	return err
 }
+
+// getPortForwards determines which ports should be forwarded, either from --port, or by prompting the user
+// to choose from the container's port mappings
+func (e *App) getPortForwards() ([]portForward, error) {
+	if ports := viper.GetString("port"); ports != "" {
+		forwards, err := parsePortForwards(ports)
+		if err != nil {
+			return nil, err
+		}
+		for i := range forwards {
+			forwards[i].freeLocalPort = isFreeLocalPort(forwards[i].localPort)
+			if forwards[i].localPort, err = allocateLocalPort(forwards[i].localPort); err != nil {
+				return nil, err
+			}
+		}
+		return forwards, nil
+	}
+
+	var remotePorts []string
+	if remoteHost := viper.GetString("remote-host"); remoteHost != "" {
+		remotePort := viper.GetString("remote-port")
+		if remotePort == "" {
+			var err error
+			remotePort, err = e.prompt.InputRemotePort(remoteHost)
+			if err != nil {
+				return nil, err
+			}
+		}
+		remotePorts = append(remotePorts, remotePort)
+	} else {
+		containerPorts, err := getContainerPorts(e.client, *e.task.TaskDefinitionArn, *e.container.Name)
+		if err != nil {
+			return nil, err
+		}
+		if len(containerPorts) > 1 {
+			if e.nonInteractive {
+				var candidates []string
+				for _, p := range containerPorts {
+					candidates = append(candidates, fmt.Sprint(p))
+				}
+				return nil, &AmbiguousTargetError{Resource: "port", Candidates: candidates}
+			}
+			containerPorts, err = e.prompt.SelectPorts(containerPorts)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, p := range containerPorts {
+			remotePorts = append(remotePorts, fmt.Sprint(p))
+		}
+	}
+
+	var forwards []portForward
+	for _, remotePort := range remotePorts {
+		localPort := viper.GetString("local-port")
+		if localPort == "" || len(remotePorts) > 1 {
+			if e.nonInteractive {
+				return nil, errors.New("a local port must be specified with --local-port, use 0 to pick a free port")
+			}
+			var err error
+			localPort, err = e.prompt.InputLocalPort(remotePort)
+			if err != nil {
+				return nil, err
+			}
+		}
+		allocated, err := allocateLocalPort(localPort)
+		if err != nil {
+			return nil, err
+		}
+		forwards = append(forwards, portForward{localPort: allocated, remotePort: remotePort, freeLocalPort: isFreeLocalPort(localPort)})
+	}
+
+	return forwards, nil
+}
+
+// validateLocalPort checks that the local port is a number between 0 and 65535, without binding it
+func validateLocalPort(port string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(port))
+	if err != nil || n < 0 || n > 65535 {
+		return 0, fmt.Errorf("invalid local port %q, must be a number between 1 and 65535 (or 0 to pick a free port)", port)
+	}
+	return n, nil
+}
+
+// isFreeLocalPort reports whether the local port asks for a free port to be picked
+func isFreeLocalPort(port string) bool {
+	n, err := validateLocalPort(port)
+	return err == nil && n == 0
+}
+
+// allocateLocalPort checks that the local port is valid and free on the loopback interface. If the port
+// is 0 then a free port is picked for us.
+func allocateLocalPort(port string) (string, error) {
+	n, err := validateLocalPort(port)
+	if err != nil {
+		return "", err
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", n))
+	if err != nil {
+		return "", fmt.Errorf("local port %d is already in use", n)
+	}
+	defer listener.Close()
+
+	allocated := listener.Addr().(*net.TCPAddr).Port
+	if n == 0 && !viper.GetBool("quiet") && outputMode() != "json" {
+		fmt.Printf("Using free local port %s\n", Green(allocated))
+	}
+
+	return fmt.Sprint(allocated), nil
+}
+
+// parsePortForwards parses a comma separated list of local:remote port pairs. If only a single port is
+// given then the same port is used locally and remotely. A local port of 0 picks a free port.
+func parsePortForwards(ports string) ([]portForward, error) {
+	var forwards []portForward
+	for _, pair := range strings.Split(ports, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		split := strings.Split(pair, ":")
+		if len(split) > 2 {
+			return nil, fmt.Errorf("invalid port mapping %q, expected local:remote", pair)
+		}
+		f := portForward{localPort: split[0], remotePort: split[len(split)-1]}
+		if n, err := strconv.Atoi(f.localPort); err != nil || n < 0 || n > 65535 {
+			return nil, fmt.Errorf("invalid port %q in port mapping %q", f.localPort, pair)
+		}
+		if n, err := strconv.Atoi(f.remotePort); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid port %q in port mapping %q", f.remotePort, pair)
+		}
+		forwards = append(forwards, f)
+	}
+	if len(forwards) == 0 {
+		return nil, errors.New("no ports specified")
+	}
+
+	return forwards, nil
+}
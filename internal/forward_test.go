@@ -1 +1,216 @@
 package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePortForwards(t *testing.T) {
+	cases := []struct {
+		name     string
+		ports    string
+		expected []portForward
+		err      bool
+	}{
+		{
+			name:  "TestParsePortForwardsWithPairs",
+			ports: "8080:80, 9090:9000",
+			expected: []portForward{
+				{localPort: "8080", remotePort: "80"},
+				{localPort: "9090", remotePort: "9000"},
+			},
+		},
+		{
+			name:  "TestParsePortForwardsWithSinglePort",
+			ports: "5432",
+			expected: []portForward{
+				{localPort: "5432", remotePort: "5432"},
+			},
+		},
+		{
+			name:  "TestParsePortForwardsWithInvalidPort",
+			ports: "8080:http",
+			err:   true,
+		},
+		{
+			name:  "TestParsePortForwardsWithTooManyParts",
+			ports: "8080:80:90",
+			err:   true,
+		},
+	}
+
+	for _, c := range cases {
+		res, err := parsePortForwards(c.ports)
+		if ok := assert.Equal(t, c.err, err != nil); ok != true {
+			fmt.Printf("%s FAILED\n", c.name)
+		}
+		if ok := assert.Equal(t, c.expected, res); ok != true {
+			fmt.Printf("%s FAILED\n", c.name)
+		}
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+}
+
+func TestAllocateLocalPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	inUse := fmt.Sprint(listener.Addr().(*net.TCPAddr).Port)
+
+	_, err = allocateLocalPort(inUse)
+	assert.EqualError(t, err, fmt.Sprintf("local port %s is already in use", inUse))
+
+	_, err = allocateLocalPort("http")
+	assert.NotNil(t, err)
+
+	_, err = allocateLocalPort("70000")
+	assert.NotNil(t, err)
+
+	port, err := allocateLocalPort("0")
+	assert.Nil(t, err)
+	assert.NotEqual(t, "0", port)
+}
+
+func TestValidateLocalPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	inUse := listener.Addr().(*net.TCPAddr).Port
+
+	// Validation doesn't bind the port, so ports in use and 0 are returned as they are
+	port, err := validateLocalPort(fmt.Sprint(inUse))
+	assert.Nil(t, err)
+	assert.Equal(t, inUse, port)
+	port, err = validateLocalPort("0")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, port)
+
+	_, err = validateLocalPort("http")
+	assert.NotNil(t, err)
+	_, err = validateLocalPort("-1")
+	assert.NotNil(t, err)
+}
+
+type SSMClientMock struct {
+	StartSessionMock func(ctx context.Context, params *ssm.StartSessionInput, optFns ...func(*ssm.Options)) (*ssm.StartSessionOutput, error)
+}
+
+func (m SSMClientMock) StartSession(ctx context.Context, params *ssm.StartSessionInput, optFns ...func(*ssm.Options)) (*ssm.StartSessionOutput, error) {
+	return m.StartSessionMock(ctx, params, optFns...)
+}
+
+func TestExecuteForward(t *testing.T) {
+	useTempHistory(t)
+	cases := []struct {
+		name       string
+		remoteHost string
+		document   string
+	}{
+		{name: "TestExecuteForwardToContainer", document: "AWS-StartPortForwardingSession"},
+		{name: "TestExecuteForwardToRemoteHost", remoteHost: "mydb.example.com", document: "AWS-StartPortForwardingSessionToRemoteHost"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			viper.Set("port", "0:5432")
+			viper.Set("remote-host", c.remoteHost)
+			viper.Set("quiet", true)
+			defer viper.Set("port", "")
+			defer viper.Set("remote-host", "")
+			defer viper.Set("quiet", false)
+
+			var inputs []*ssm.StartSessionInput
+			app := CreateMockApp(ECSClientMock{})
+			app.profile = "prod"
+			app.region = "us-east-1"
+			app.cluster = "App"
+			app.task = &ecsTypes.Task{
+				TaskArn:           aws.String("arn:aws:ecs:us-east-1:111111111111:task/App/8a58117dac38436ba5547e9da5d3ac3d"),
+				TaskDefinitionArn: aws.String("arn:aws:ecs:us-east-1:111111111111:task-definition/db:1"),
+			}
+			app.container = &ecsTypes.Container{Name: aws.String("app"), RuntimeId: aws.String("8a58117dac38436ba5547e9da5d3ac3d-1234")}
+			app.clients = ClientFactoryMock{
+				SSMMock: func(profile string, region string) (SSMClient, error) {
+					// The SSM client must be for the same profile and region as the task
+					assert.Equal(t, "prod", profile)
+					assert.Equal(t, "us-east-1", region)
+					return SSMClientMock{
+						StartSessionMock: func(ctx context.Context, params *ssm.StartSessionInput, optFns ...func(*ssm.Options)) (*ssm.StartSessionOutput, error) {
+							inputs = append(inputs, params)
+							return &ssm.StartSessionOutput{SessionId: aws.String("session")}, nil
+						},
+					}, nil
+				},
+			}
+
+			assert.Nil(t, app.executeForward())
+			assert.Len(t, inputs, 1)
+			assert.Equal(t, c.document, *inputs[0].DocumentName)
+			assert.Equal(t, "ecs:App_8a58117dac38436ba5547e9da5d3ac3d_8a58117dac38436ba5547e9da5d3ac3d-1234", *inputs[0].Target)
+			assert.Equal(t, []string{"5432"}, inputs[0].Parameters["portNumber"])
+			if c.remoteHost != "" {
+				assert.Equal(t, []string{c.remoteHost}, inputs[0].Parameters["host"])
+			}
+			fmt.Printf("%s PASSED\n", c.name)
+		})
+	}
+}
+
+func TestExecuteForwardHistory(t *testing.T) {
+	cases := []struct {
+		name    string
+		err     error
+		entries int
+	}{
+		{name: "TestExecuteForwardHistoryRecordsStartedSession", entries: 1},
+		{name: "TestExecuteForwardHistorySkipsFailedSession", err: errors.New("TargetNotConnected"), entries: 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			useTempHistory(t)
+			viper.Set("port", "0:5432")
+			viper.Set("quiet", true)
+			defer viper.Set("port", "")
+			defer viper.Set("quiet", false)
+
+			app := CreateMockApp(ECSClientMock{})
+			app.cluster = "App"
+			app.task = &ecsTypes.Task{
+				TaskArn:           aws.String("arn:aws:ecs:us-east-1:111111111111:task/App/8a58117dac38436ba5547e9da5d3ac3d"),
+				TaskDefinitionArn: aws.String("arn:aws:ecs:us-east-1:111111111111:task-definition/db:1"),
+			}
+			app.container = &ecsTypes.Container{Name: aws.String("app"), RuntimeId: aws.String("8a58117dac38436ba5547e9da5d3ac3d-1234")}
+			app.clients = ClientFactoryMock{
+				SSMMock: func(profile string, region string) (SSMClient, error) {
+					return SSMClientMock{
+						StartSessionMock: func(ctx context.Context, params *ssm.StartSessionInput, optFns ...func(*ssm.Options)) (*ssm.StartSessionOutput, error) {
+							if c.err != nil {
+								return nil, c.err
+							}
+							return &ssm.StartSessionOutput{SessionId: aws.String("session")}, nil
+						},
+					}, nil
+				},
+			}
+
+			err := app.executeForward()
+			assert.Equal(t, c.err != nil, err != nil)
+
+			// Only targets which a session was started against are saved
+			history, err := LoadHistory()
+			assert.Nil(t, err)
+			assert.Len(t, history, c.entries)
+			fmt.Printf("%s PASSED\n", c.name)
+		})
+	}
+}
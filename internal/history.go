@@ -0,0 +1,279 @@
+/* history.go contains the logic for recording recent connections and reconnecting to them */
+
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/spf13/viper"
+)
+
+const maxHistoryEntries = 50
+
+// HistoryEntry records a connection made by ecsgo. Task IDs change with every deployment, so we record the
+// service and task definition family in order to find a current task when reconnecting.
+type HistoryEntry struct {
+	Profile         string    `json:"profile,omitempty"`
+	RoleArn         string    `json:"roleArn,omitempty"`
+	ExternalID      string    `json:"externalId,omitempty"`
+	RoleSessionName string    `json:"roleSessionName,omitempty"`
+	MFASerial       string    `json:"mfaSerial,omitempty"`
+	Region          string    `json:"region"`
+	Cluster         string    `json:"cluster"`
+	Service         string    `json:"service,omitempty"`
+	TaskFamily      string    `json:"taskFamily"`
+	Container       string    `json:"container"`
+	Command         string    `json:"command,omitempty"`
+	Forward         bool      `json:"forward,omitempty"`
+	Ports           string    `json:"ports,omitempty"`
+	RemoteHost      string    `json:"remoteHost,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+func (h HistoryEntry) String() string {
+	target := h.Cluster
+	if h.Service != "" {
+		target = fmt.Sprintf("%s/%s", target, h.Service)
+	} else {
+		target = fmt.Sprintf("%s/%s", target, h.TaskFamily)
+	}
+	action := h.Command
+	if h.Forward {
+		action = fmt.Sprintf("forward %s", h.Ports)
+		if h.RemoteHost != "" {
+			action = fmt.Sprintf("%s via %s", action, h.RemoteHost)
+		}
+	}
+	account := h.Region
+	if h.Profile != "" {
+		account = fmt.Sprintf("%s/%s", h.Profile, h.Region)
+	}
+
+	return fmt.Sprintf("%s | %s | %s | %s | %s", h.Timestamp.Local().Format("2006-01-02 15:04"), account, target, h.Container, action)
+}
+
+// sameTarget reports whether two entries would connect to the same place
+func (h HistoryEntry) sameTarget(other HistoryEntry) bool {
+	other.Timestamp = h.Timestamp
+	return h == other
+}
+
+// historyFile returns the path of the history file, which can be overridden with the history-file setting
+func historyFile() string {
+	if file := viper.GetString("history-file"); file != "" {
+		return file
+	}
+
+	return filepath.Join(ConfigDir(), "history.json")
+}
+
+// LoadHistory returns the recorded connections, most recent first
+func LoadHistory() ([]HistoryEntry, error) {
+	data, err := os.ReadFile(historyFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var history []HistoryEntry
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("unable to read history file %s: %w", historyFile(), err)
+	}
+
+	return history, nil
+}
+
+// addHistory records the entry as the most recent connection, replacing any previous entry for the same target
+func addHistory(entry HistoryEntry) error {
+	history, err := LoadHistory()
+	if err != nil {
+		return err
+	}
+
+	updated := []HistoryEntry{entry}
+	for _, h := range history {
+		if !h.sameTarget(entry) {
+			updated = append(updated, h)
+		}
+	}
+	if len(updated) > maxHistoryEntries {
+		updated = updated[:maxHistoryEntries]
+	}
+
+	data, err := json.MarshalIndent(updated, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(historyFile()), 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(historyFile(), data, 0600)
+}
+
+// recordHistory adds the current target to the history file. Failing to record history shouldn't stop
+// the user from connecting, so errors are only printed.
+func (e *App) recordHistory(command string, forwards []portForward) {
+	// Reconnecting would pick one of the service's tasks rather than a new debug task
+	if e.debug != nil {
+		return
+	}
+
+	entry := HistoryEntry{
+		Profile:         e.profile,
+		RoleArn:         viper.GetString("role-arn"),
+		ExternalID:      viper.GetString("external-id"),
+		RoleSessionName: viper.GetString("role-session-name"),
+		MFASerial:       viper.GetString("mfa-serial"),
+		Region:          e.region,
+		Cluster:         e.cluster,
+		TaskFamily:      taskFamily(aws.ToString(e.task.TaskDefinitionArn)),
+		Container:       *e.container.Name,
+		Command:         command,
+		Forward:         len(forwards) > 0,
+		RemoteHost:      viper.GetString("remote-host"),
+		Timestamp:       time.Now().UTC(),
+	}
+	if e.service != "*" && e.service != standaloneTasks {
+		entry.Service = e.service
+	}
+	var ports []string
+	for _, f := range forwards {
+		// Record a port which was picked for us as 0, so that reconnecting picks a free port again
+		localPort := f.localPort
+		if f.freeLocalPort {
+			localPort = "0"
+		}
+		ports = append(ports, fmt.Sprintf("%s:%s", localPort, f.remotePort))
+	}
+	entry.Ports = strings.Join(ports, ",")
+
+	if err := addHistory(entry); err != nil {
+		fmt.Fprintln(os.Stderr, Yellow(fmt.Sprintf("Unable to record connection history: %s", err)))
+	}
+}
+
+// taskFamily returns the family from a task definition ARN, e.g. arn:aws:ecs:...:task-definition/nginx:3 -> nginx
+func taskFamily(taskDefinitionArn string) string {
+	family, _ := splitTaskDefinition(taskDefinitionArn)
+	return family
+}
+
+// Reconnect connects to the target recorded in the history entry, using a task which is currently running
+// the same service (or task definition family) and container. Settings which have been explicitly set
+// according to isSet take precedence over those recorded in the entry.
+func Reconnect(entry HistoryEntry, isSet func(key string) bool) error {
+	entry, err := applyHistory(entry, isSet)
+	if err != nil {
+		return err
+	}
+
+	e := CreateApp()
+	e.cluster = entry.Cluster
+	taskId, err := e.resolveHistoryTask(entry)
+	if err != nil {
+		return e.translateError(err)
+	}
+	e.service = entry.Service
+	viper.Set("service", "")
+	viper.Set("task", taskId)
+
+	return e.Start()
+}
+
+// applyHistory sets each setting recorded in the history entry which hasn't been explicitly set according to
+// isSet, and returns the entry updated with the settings which were
+func applyHistory(entry HistoryEntry, isSet func(key string) bool) (HistoryEntry, error) {
+	// A local port given with --local-port replaces the one recorded for a single forwarded port
+	if isSet("local-port") && !isSet("port") && entry.Ports != "" {
+		forwards, err := parsePortForwards(entry.Ports)
+		if err != nil {
+			return entry, err
+		}
+		if len(forwards) > 1 {
+			return entry, fmt.Errorf("--local-port can't be used when reconnecting to several forwarded ports (%s), use --port instead", entry.Ports)
+		}
+		entry.Ports = fmt.Sprintf("%s:%s", viper.GetString("local-port"), forwards[0].remotePort)
+	}
+
+	settings := []struct {
+		key   string
+		value interface{}
+	}{
+		{"profile", entry.Profile},
+		{"role-arn", entry.RoleArn},
+		{"external-id", entry.ExternalID},
+		{"role-session-name", entry.RoleSessionName},
+		{"mfa-serial", entry.MFASerial},
+		{"region", entry.Region},
+		{"cluster", entry.Cluster},
+		{"container", entry.Container},
+		{"cmd", entry.Command},
+		{"forward", entry.Forward},
+		{"port", entry.Ports},
+		{"remote-host", entry.RemoteHost},
+	}
+	for _, s := range settings {
+		if isSet(s.key) {
+			continue
+		}
+		viper.Set(s.key, s.value)
+	}
+	entry.Cluster = viper.GetString("cluster")
+	entry.Container = viper.GetString("container")
+
+	return entry, nil
+}
+
+// resolveHistoryTask finds a task that is currently running the container recorded in the history entry,
+// preferring the most recently started
+func (e *App) resolveHistoryTask(entry HistoryEntry) (string, error) {
+	input := &ecs.ListTasksInput{
+		Cluster:       aws.String(entry.Cluster),
+		DesiredStatus: ecsTypes.DesiredStatusRunning,
+		MaxResults:    awsMaxResults,
+	}
+	if entry.Service != "" {
+		input.ServiceName = aws.String(entry.Service)
+	} else {
+		input.Family = aws.String(entry.TaskFamily)
+	}
+
+	taskArns, err := listTaskArns(e.client, input)
+	if err != nil {
+		return "", err
+	}
+	tasks, err := describeTasks(e.client, entry.Cluster, taskArns, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var candidates []ecsTypes.Task
+	for _, t := range tasks {
+		task := t
+		if taskFamily(aws.ToString(task.TaskDefinitionArn)) == entry.TaskFamily && healthyContainer(&task, entry.Container) != nil {
+			candidates = append(candidates, task)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no running tasks found for %s/%s with container %s", entry.Cluster, entry.TaskFamily, entry.Container)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return aws.ToTime(candidates[i].StartedAt).After(aws.ToTime(candidates[j].StartedAt))
+	})
+
+	return strings.Split(*candidates[0].TaskArn, "/")[2], nil
+}
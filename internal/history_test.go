@@ -0,0 +1,234 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddHistory(t *testing.T) {
+	useTempHistory(t)
+
+	for i := 0; i < maxHistoryEntries+5; i++ {
+		err := addHistory(HistoryEntry{
+			Cluster:   "App",
+			Service:   fmt.Sprintf("service-%d", i),
+			Container: "nginx",
+			Timestamp: time.Unix(int64(i), 0).UTC(),
+		})
+		assert.Nil(t, err)
+	}
+
+	// Reconnecting to an existing target moves it to the top rather than duplicating it
+	err := addHistory(HistoryEntry{
+		Cluster:   "App",
+		Service:   "service-20",
+		Container: "nginx",
+		Timestamp: time.Unix(100, 0).UTC(),
+	})
+	assert.Nil(t, err)
+
+	history, err := LoadHistory()
+	assert.Nil(t, err)
+	assert.Len(t, history, maxHistoryEntries)
+	assert.Equal(t, "service-20", history[0].Service)
+	assert.Equal(t, "service-54", history[1].Service)
+	for _, h := range history[1:] {
+		assert.NotEqual(t, "service-20", h.Service)
+	}
+}
+
+func TestTaskFamily(t *testing.T) {
+	assert.Equal(t, "nginx", taskFamily("arn:aws:ecs:eu-west-1:111111111111:task-definition/nginx:3"))
+	assert.Equal(t, "nginx", taskFamily("nginx"))
+}
+
+func TestResolveHistoryTask(t *testing.T) {
+	now := time.Now()
+	tasks := []ecsTypes.Task{
+		{
+			TaskArn:           aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/older"),
+			TaskDefinitionArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/nginx:3"),
+			LastStatus:        aws.String("RUNNING"),
+			StartedAt:         aws.Time(now.Add(-time.Hour)),
+			Containers:        []ecsTypes.Container{{Name: aws.String("nginx"), LastStatus: aws.String("RUNNING"), RuntimeId: aws.String("a")}},
+		},
+		{
+			TaskArn:           aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/newer"),
+			TaskDefinitionArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/nginx:4"),
+			LastStatus:        aws.String("RUNNING"),
+			StartedAt:         aws.Time(now),
+			Containers:        []ecsTypes.Container{{Name: aws.String("nginx"), LastStatus: aws.String("RUNNING"), RuntimeId: aws.String("b")}},
+		},
+		{
+			TaskArn:           aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/other"),
+			TaskDefinitionArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/redis:1"),
+			LastStatus:        aws.String("RUNNING"),
+			StartedAt:         aws.Time(now.Add(time.Hour)),
+			Containers:        []ecsTypes.Container{{Name: aws.String("nginx"), LastStatus: aws.String("RUNNING"), RuntimeId: aws.String("c")}},
+		},
+	}
+
+	client := ECSClientMock{
+		ListTasksMock: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			assert.Equal(t, "api", *input.ServiceName)
+			var arns []string
+			for _, t := range tasks {
+				arns = append(arns, *t.TaskArn)
+			}
+			return &ecs.ListTasksOutput{TaskArns: arns}, nil
+		},
+		DescribeTasksMock: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+			return &ecs.DescribeTasksOutput{Tasks: tasks}, nil
+		},
+	}
+
+	app := CreateMockApp(client)
+	taskId, err := app.resolveHistoryTask(HistoryEntry{
+		Cluster:    "App",
+		Service:    "api",
+		TaskFamily: "nginx",
+		Container:  "nginx",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "newer", taskId)
+
+	_, err = app.resolveHistoryTask(HistoryEntry{
+		Cluster:    "App",
+		Service:    "api",
+		TaskFamily: "nginx",
+		Container:  "sidecar",
+	})
+	assert.NotNil(t, err)
+}
+
+func TestApplyHistory(t *testing.T) {
+	entry := HistoryEntry{
+		RoleArn:    "arn:aws:iam::111111111111:role/history",
+		ExternalID: "abc123",
+		MFASerial:  "arn:aws:iam::111111111111:mfa/jane",
+		Region:     "eu-west-1",
+		Cluster:    "App",
+		Service:    "api",
+		Container:  "nginx",
+		Forward:    true,
+		Ports:      "0:80",
+	}
+	cases := []struct {
+		name      string
+		flags     map[string]interface{}
+		entry     HistoryEntry
+		expected  map[string]interface{}
+		container string
+		err       bool
+	}{
+		{
+			name:      "TestApplyHistoryWithoutFlags",
+			entry:     entry,
+			expected:  map[string]interface{}{"role-arn": "arn:aws:iam::111111111111:role/history", "external-id": "abc123", "mfa-serial": "arn:aws:iam::111111111111:mfa/jane", "port": "0:80"},
+			container: "nginx",
+		},
+		{
+			name:      "TestApplyHistoryWithFlags",
+			flags:     map[string]interface{}{"role-arn": "arn:aws:iam::111111111111:role/flag", "container": "sidecar"},
+			entry:     entry,
+			expected:  map[string]interface{}{"role-arn": "arn:aws:iam::111111111111:role/flag", "port": "0:80"},
+			container: "sidecar",
+		},
+		{
+			name:      "TestApplyHistoryWithLocalPort",
+			flags:     map[string]interface{}{"local-port": "9000"},
+			entry:     entry,
+			expected:  map[string]interface{}{"port": "9000:80"},
+			container: "nginx",
+		},
+		{
+			name:  "TestApplyHistoryWithLocalPortForSeveralPorts",
+			flags: map[string]interface{}{"local-port": "9000"},
+			entry: HistoryEntry{Cluster: "App", Container: "nginx", Forward: true, Ports: "0:80,0:443"},
+			err:   true,
+		},
+	}
+
+	for _, c := range cases {
+		for key, value := range c.flags {
+			viper.Set(key, value)
+		}
+		isSet := func(key string) bool {
+			_, ok := c.flags[key]
+			return ok
+		}
+
+		applied, err := applyHistory(c.entry, isSet)
+		if c.err {
+			assert.NotNil(t, err, c.name)
+		} else {
+			assert.Nil(t, err, c.name)
+			assert.Equal(t, c.container, applied.Container, c.name)
+			for key, value := range c.expected {
+				assert.Equal(t, value, viper.Get(key), c.name)
+			}
+		}
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+	for _, key := range []string{"role-arn", "external-id", "role-session-name", "mfa-serial", "region", "cluster", "container", "cmd", "forward", "port", "remote-host", "local-port"} {
+		viper.Set(key, nil)
+	}
+}
+
+func TestRecordHistoryFreeLocalPort(t *testing.T) {
+	useTempHistory(t)
+
+	app := CreateMockApp(ECSClientMock{})
+	app.cluster = "App"
+	app.service = "api"
+	app.task = &ecsTypes.Task{TaskDefinitionArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/nginx:3")}
+	app.container = &ecsTypes.Container{Name: aws.String("nginx")}
+	app.recordHistory("", []portForward{
+		{localPort: "49152", remotePort: "80", freeLocalPort: true},
+		{localPort: "9443", remotePort: "443"},
+	})
+
+	history, err := LoadHistory()
+	assert.Nil(t, err)
+	assert.Len(t, history, 1)
+	// The port picked for us isn't recorded, so that a free one is picked again when reconnecting
+	assert.Equal(t, "0:80,9443:443", history[0].Ports)
+}
+
+func TestRecordHistoryAssumeRole(t *testing.T) {
+	useTempHistory(t)
+	settings := map[string]string{
+		"role-arn":          "arn:aws:iam::111111111111:role/ecsgo",
+		"external-id":       "abc123",
+		"role-session-name": "jane",
+		"mfa-serial":        "arn:aws:iam::111111111111:mfa/jane",
+	}
+	for key, value := range settings {
+		viper.Set(key, value)
+		defer viper.Set(key, "")
+	}
+
+	app := CreateMockApp(ECSClientMock{})
+	app.cluster = "App"
+	app.service = "api"
+	app.task = &ecsTypes.Task{TaskDefinitionArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/nginx:3")}
+	app.container = &ecsTypes.Container{Name: aws.String("nginx")}
+	app.recordHistory("/bin/sh", nil)
+
+	// Everything needed to assume the role again is recorded
+	history, err := LoadHistory()
+	assert.Nil(t, err)
+	assert.Len(t, history, 1)
+	assert.Equal(t, "arn:aws:iam::111111111111:role/ecsgo", history[0].RoleArn)
+	assert.Equal(t, "abc123", history[0].ExternalID)
+	assert.Equal(t, "jane", history[0].RoleSessionName)
+	assert.Equal(t, "arn:aws:iam::111111111111:mfa/jane", history[0].MFASerial)
+}
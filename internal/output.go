@@ -0,0 +1,148 @@
+/* output.go contains the logic for capturing and emitting the output of non-interactive commands */
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// commandResult describes the outcome of running a non-interactive command on a container
+type commandResult struct {
+	Cluster   string  `json:"cluster"`
+	Service   string  `json:"service,omitempty"`
+	Task      string  `json:"task"`
+	Container string  `json:"container"`
+	Command   string  `json:"command"`
+	ExitCode  *int    `json:"exitCode,omitempty"` // only known with the built-in session client, the session-manager-plugin doesn't report it
+	Duration  float64 `json:"durationSeconds"`
+	Stdout    string  `json:"stdout"`
+	Stderr    string  `json:"stderr"`
+	Error     string  `json:"error,omitempty"`
+
+	err      error
+	duration time.Duration
+}
+
+func (r *commandResult) setError(err error) {
+	r.err = err
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+func (r *commandResult) setDuration(d time.Duration) {
+	r.duration = d
+	r.Duration = d.Round(time.Millisecond).Seconds()
+}
+
+// captureCommand runs the command on the selected container with its output captured rather than streamed,
+// and emits the result in the requested format
+func (e *App) captureCommand() error {
+	command := viper.GetString("cmd")
+	if command == "" {
+		return errors.New("a command must be specified with --cmd when capturing output")
+	}
+	var stdout, stderr bytes.Buffer
+	result := e.executeOnTask(e.task, *e.container.Name, command, nil, &stdout, &stderr)
+	result.Stdout = cleanSessionOutput(stdout.String())
+	result.Stderr = cleanSessionOutput(stderr.String())
+
+	if err := writeResults([]commandResult{result}); err != nil {
+		return err
+	}
+
+	return result.err
+}
+
+// outputMode returns the format that command output should be captured in, or an empty string if output
+// should be streamed straight to the terminal
+func outputMode() string {
+	format := strings.ToLower(viper.GetString("output"))
+	if format == "" && viper.GetString("output-dir") != "" {
+		format = "text"
+	}
+
+	return format
+}
+
+// writeResults emits captured command output in the requested format, either to stdout or to a file per task
+// when --output-dir is set
+func writeResults(results []commandResult) error {
+	format := outputMode()
+
+	if dir := viper.GetString("output-dir"); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		for _, r := range results {
+			var data []byte
+			path := filepath.Join(dir, fmt.Sprintf("%s.log", r.Task))
+			if format == "json" {
+				path = filepath.Join(dir, fmt.Sprintf("%s.json", r.Task))
+				b, err := json.MarshalIndent(r, "", "    ")
+				if err != nil {
+					return err
+				}
+				data = append(b, '\n')
+			} else {
+				data = []byte(r.Stdout + r.Stderr)
+			}
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				return err
+			}
+			if !viper.GetBool("quiet") {
+				fmt.Fprintf(os.Stderr, "Wrote output for task %s to %s\n", Green(r.Task), path)
+			}
+		}
+		return nil
+	}
+
+	if format == "json" {
+		b, err := json.MarshalIndent(results, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	for _, r := range results {
+		if len(results) > 1 {
+			if r.ExitCode != nil {
+				fmt.Printf("==> %s/%s (exit code %d) <==\n", r.Task, r.Container, *r.ExitCode)
+			} else {
+				fmt.Printf("==> %s/%s <==\n", r.Task, r.Container)
+			}
+		}
+		fmt.Print(r.Stdout)
+		fmt.Fprint(os.Stderr, r.Stderr)
+	}
+
+	return nil
+}
+
+// cleanSessionOutput strips the banner lines printed by the session-manager-plugin and normalises the
+// carriage returns added by the remote terminal, leaving only the output of the command itself
+func cleanSessionOutput(output string) string {
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+
+	var lines []string
+	for _, line := range strings.SplitAfter(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "Starting session with SessionId:") || strings.HasPrefix(trimmed, "Exiting session with sessionId:") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.TrimLeft(strings.Join(lines, ""), "\n")
+}
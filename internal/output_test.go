@@ -0,0 +1,47 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanSessionOutput(t *testing.T) {
+	cases := []struct {
+		name     string
+		output   string
+		expected string
+	}{
+		{
+			name:     "TestCleanSessionOutputStripsBanner",
+			output:   "\r\nStarting session with SessionId: ecs-execute-command-0e86561fddf625dc1\r\nMemTotal: 8000 kB\r\nMemFree: 4000 kB\r\n\r\n\r\nExiting session with sessionId: ecs-execute-command-0e86561fddf625dc1.\r\n\r\n",
+			expected: "MemTotal: 8000 kB\nMemFree: 4000 kB\n\n\n\n",
+		},
+		{
+			name:     "TestCleanSessionOutputWithoutBanner",
+			output:   "hello\r\n",
+			expected: "hello\n",
+		},
+	}
+
+	for _, c := range cases {
+		if ok := assert.Equal(t, c.expected, cleanSessionOutput(c.output)); ok != true {
+			fmt.Printf("%s FAILED\n", c.name)
+		}
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+}
+
+func TestCommandResultExitCode(t *testing.T) {
+	// The exit code is left out when the session-manager-plugin was used, as it isn't the command's
+	b, err := json.Marshal(commandResult{Task: "1"})
+	assert.Nil(t, err)
+	assert.NotContains(t, string(b), "exitCode")
+
+	code := 0
+	b, err = json.Marshal(commandResult{Task: "1", ExitCode: &code})
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"exitCode":0`)
+}
@@ -0,0 +1,156 @@
+/* paginate.go contains the logic for listing and describing ECS resources across pages and batches */
+
+package app
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+const (
+	describeClustersBatchSize = 100 // the most clusters DescribeClusters accepts in one call
+	describeTasksBatchSize    = 100 // the most tasks DescribeTasks accepts in one call
+	describeServicesBatchSize = 10  // the most services DescribeServices accepts in one call
+	describeConcurrency       = 5   // the most describe calls made at once
+)
+
+// listAll calls list for each page of results until there are no more. The same input is used for every page
+// with only the token changed, so filters such as ServiceName apply to every page and not just the first.
+func listAll[In any](input *In, setToken func(*In, *string), list func(*In) ([]string, *string, error)) ([]string, error) {
+	var items []string
+	for {
+		page, token, err := list(input)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+		if token == nil {
+			return items, nil
+		}
+		setToken(input, token)
+	}
+}
+
+// describeInBatches splits ids into batches of at most size and describes the batches concurrently, returning
+// the results in the same order as the ids
+func describeInBatches[T any](ids []string, size int, describe func(batch []string) ([]T, error)) ([]T, error) {
+	var batches [][]string
+	for start := 0; start < len(ids); start += size {
+		end := start + size
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batches = append(batches, ids[start:end])
+	}
+
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, describeConcurrency)
+		results = make([][]T, len(batches))
+		errs    = make([]error, len(batches))
+	)
+	for i, batch := range batches {
+		wg.Add(1)
+		go func(i int, batch []string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], errs[i] = describe(batch)
+		}(i, batch)
+	}
+	wg.Wait()
+
+	var all []T
+	for i := range batches {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		all = append(all, results[i]...)
+	}
+
+	return all, nil
+}
+
+// listClusterArns returns the ARN of every cluster visible to the client
+func listClusterArns(client ECSClient) ([]string, error) {
+	input := &ecs.ListClustersInput{MaxResults: awsMaxResults}
+	return listAll(input, func(i *ecs.ListClustersInput, token *string) { i.NextToken = token },
+		func(i *ecs.ListClustersInput) ([]string, *string, error) {
+			list, err := client.ListClusters(context.TODO(), i)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.ClusterArns, list.NextToken, nil
+		})
+}
+
+// listServiceArns returns the ARN of every service in the cluster
+func listServiceArns(client ECSClient, cluster string) ([]string, error) {
+	input := &ecs.ListServicesInput{Cluster: aws.String(cluster), MaxResults: awsMaxResults}
+	return listAll(input, func(i *ecs.ListServicesInput, token *string) { i.NextToken = token },
+		func(i *ecs.ListServicesInput) ([]string, *string, error) {
+			list, err := client.ListServices(context.TODO(), i)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.ServiceArns, list.NextToken, nil
+		})
+}
+
+// listTaskArns returns the ARN of every task matching the input
+func listTaskArns(client ECSClient, input *ecs.ListTasksInput) ([]string, error) {
+	return listAll(input, func(i *ecs.ListTasksInput, token *string) { i.NextToken = token },
+		func(i *ecs.ListTasksInput) ([]string, *string, error) {
+			list, err := client.ListTasks(context.TODO(), i)
+			if err != nil {
+				return nil, nil, err
+			}
+			return list.TaskArns, list.NextToken, nil
+		})
+}
+
+// describeClusters describes the clusters, in batches of up to 100
+func describeClusters(client ECSClient, clusterArns []string) ([]ecsTypes.Cluster, error) {
+	return describeInBatches(clusterArns, describeClustersBatchSize, func(batch []string) ([]ecsTypes.Cluster, error) {
+		describe, err := client.DescribeClusters(context.TODO(), &ecs.DescribeClustersInput{
+			Clusters: batch,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return describe.Clusters, nil
+	})
+}
+
+// describeTasks describes the tasks in the cluster, in batches of up to 100
+func describeTasks(client ECSClient, cluster string, taskArns []string, include []ecsTypes.TaskField) ([]ecsTypes.Task, error) {
+	return describeInBatches(taskArns, describeTasksBatchSize, func(batch []string) ([]ecsTypes.Task, error) {
+		describe, err := client.DescribeTasks(context.TODO(), &ecs.DescribeTasksInput{
+			Cluster: aws.String(cluster),
+			Tasks:   batch,
+			Include: include,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return describe.Tasks, nil
+	})
+}
+
+// describeServices describes the services in the cluster, in batches of up to 10
+func describeServices(client ECSClient, cluster string, serviceArns []string) ([]ecsTypes.Service, error) {
+	return describeInBatches(serviceArns, describeServicesBatchSize, func(batch []string) ([]ecsTypes.Service, error) {
+		describe, err := client.DescribeServices(context.TODO(), &ecs.DescribeServicesInput{
+			Cluster:  aws.String(cluster),
+			Services: batch,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return describe.Services, nil
+	})
+}
@@ -0,0 +1,174 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// pagedTasks returns a mock ListTasks which serves the tasks of a service over pages of 100, and the tasks of
+// every service when no service is given
+func pagedTasks(services map[string]int) func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+	return func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+		var arns []string
+		for service, count := range services {
+			if input.ServiceName != nil && *input.ServiceName != service {
+				continue
+			}
+			for i := 0; i < count; i++ {
+				arns = append(arns, fmt.Sprintf("arn:aws:ecs:eu-west-1:111111111111:task/App/%s-%03d", service, i))
+			}
+		}
+		start := 0
+		if input.NextToken != nil {
+			fmt.Sscan(*input.NextToken, &start)
+		}
+		end := start + int(*input.MaxResults)
+		if end >= len(arns) {
+			return &ecs.ListTasksOutput{TaskArns: arns[start:]}, nil
+		}
+		return &ecs.ListTasksOutput{TaskArns: arns[start:end], NextToken: aws.String(fmt.Sprint(end))}, nil
+	}
+}
+
+func TestListTaskArns(t *testing.T) {
+	var pages int
+	list := pagedTasks(map[string]int{"api": 250, "worker": 30})
+	client := ECSClientMock{
+		ListTasksMock: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			pages++
+			// Every page must be requested with the same filters as the first
+			assert.Equal(t, "api", aws.ToString(input.ServiceName))
+			assert.Equal(t, ecsTypes.DesiredStatusRunning, input.DesiredStatus)
+			assert.Equal(t, ecsTypes.LaunchTypeFargate, input.LaunchType)
+			return list(ctx, input, optFns...)
+		},
+	}
+
+	arns, err := listTaskArns(client, &ecs.ListTasksInput{
+		Cluster:       aws.String("App"),
+		ServiceName:   aws.String("api"),
+		DesiredStatus: ecsTypes.DesiredStatusRunning,
+		LaunchType:    ecsTypes.LaunchTypeFargate,
+		MaxResults:    awsMaxResults,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, pages)
+	assert.Len(t, arns, 250)
+	assert.Equal(t, "arn:aws:ecs:eu-west-1:111111111111:task/App/api-249", arns[249])
+}
+
+func TestDescribeInBatches(t *testing.T) {
+	cases := []struct {
+		name    string
+		count   int
+		size    int
+		batches int
+	}{
+		{name: "TestDescribeInBatchesEmpty", count: 0, size: 100, batches: 0},
+		{name: "TestDescribeInBatchesSingle", count: 100, size: 100, batches: 1},
+		{name: "TestDescribeInBatchesTasks", count: 250, size: describeTasksBatchSize, batches: 3},
+		{name: "TestDescribeInBatchesServices", count: 25, size: describeServicesBatchSize, batches: 3},
+	}
+
+	for _, c := range cases {
+		var ids []string
+		for i := 0; i < c.count; i++ {
+			ids = append(ids, fmt.Sprint(i))
+		}
+
+		var mu sync.Mutex
+		var batches int
+		results, err := describeInBatches(ids, c.size, func(batch []string) ([]string, error) {
+			assert.True(t, len(batch) <= c.size)
+			mu.Lock()
+			batches++
+			mu.Unlock()
+			return batch, nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, c.batches, batches, c.name)
+		// Results are returned in the order of the ids, regardless of which batch finished first
+		if c.count > 0 {
+			assert.Equal(t, ids, results, c.name)
+		}
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+
+	_, err := describeInBatches([]string{"1", "2", "3"}, 1, func(batch []string) ([]string, error) {
+		if batch[0] == "2" {
+			return nil, errors.New("ThrottlingException")
+		}
+		return batch, nil
+	})
+	assert.NotNil(t, err)
+}
+
+func TestDescribeServices(t *testing.T) {
+	var arns []string
+	for i := 0; i < 25; i++ {
+		arns = append(arns, fmt.Sprintf("arn:aws:ecs:eu-west-1:111111111111:service/App/service-%02d", i))
+	}
+	client := ECSClientMock{
+		DescribeServicesMock: func(ctx context.Context, input *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error) {
+			assert.Equal(t, "App", *input.Cluster)
+			assert.True(t, len(input.Services) <= 10)
+			var services []ecsTypes.Service
+			for _, arn := range input.Services {
+				services = append(services, ecsTypes.Service{ServiceArn: aws.String(arn)})
+			}
+			return &ecs.DescribeServicesOutput{Services: services}, nil
+		},
+	}
+
+	services, err := describeServices(client, "App", arns)
+	assert.Nil(t, err)
+	assert.Len(t, services, 25)
+	assert.Equal(t, arns[24], *services[24].ServiceArn)
+}
+
+func TestGetTaskWithManyTasks(t *testing.T) {
+	var describeCalls int
+	var mu sync.Mutex
+	app := CreateMockApp(ECSClientMock{
+		ListTasksMock: pagedTasks(map[string]int{"api": 250, "worker": 30}),
+		DescribeTasksMock: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+			if len(input.Tasks) > 100 {
+				return nil, &ecsTypes.InvalidParameterException{Message: aws.String("Tasks cannot be longer than 100")}
+			}
+			mu.Lock()
+			describeCalls++
+			mu.Unlock()
+			var tasks []ecsTypes.Task
+			for _, arn := range input.Tasks {
+				tasks = append(tasks, ecsTypes.Task{TaskArn: aws.String(arn), LaunchType: ecsTypes.LaunchTypeFargate})
+			}
+			return &ecs.DescribeTasksOutput{Tasks: tasks}, nil
+		},
+	})
+	app.prompt = PrompterMock{
+		SelectTaskMock: func(tasks map[string]*ecsTypes.Task, requireExec bool) (*ecsTypes.Task, error) {
+			return tasks["api-249"], nil
+		},
+	}
+	app.cluster = "App"
+	app.service = "api"
+
+	move, err := app.getTask()
+	assert.Nil(t, err)
+	assert.Equal(t, next(stepContainer), move)
+	assert.Equal(t, 3, describeCalls)
+	// Only the service's tasks are listed, on every page
+	assert.Len(t, app.tasks, 250)
+	assert.Equal(t, "arn:aws:ecs:eu-west-1:111111111111:task/App/api-249", *app.task.TaskArn)
+	for id := range app.tasks {
+		assert.Regexp(t, "^api-", id)
+	}
+}
@@ -0,0 +1,135 @@
+/* reconnect.go contains the logic for automatically reconnecting port-forward sessions */
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/spf13/viper"
+)
+
+const maxReconnectDelay = 30 * time.Second
+
+// runForward runs the port-forward session for a single port. With --reconnect the session is restarted
+// whenever it exits, against a healthy replacement task if the original is no longer running.
+func (e *App) runForward(ctx context.Context, client SSMClient, f portForward, started func(), stdout io.Writer, stderr io.Writer) error {
+	maxRetries := viper.GetInt("max-retries")
+	attempt := 0
+	for {
+		e.forwardMu.Lock()
+		target := e.sessionTarget(e.task, e.container)
+		e.forwardMu.Unlock()
+
+		began := time.Now()
+		err := e.startForward(ctx, client, target, f, started, stdout, stderr)
+		if ctx.Err() != nil || !viper.GetBool("reconnect") {
+			return err
+		}
+
+		// A session which stayed up for a while isn't a failed attempt, so start backing off from scratch
+		if time.Since(began) > time.Minute {
+			attempt = 0
+		}
+		attempt++
+		if attempt > maxRetries {
+			return fmt.Errorf("giving up after %d reconnect attempts: %v", maxRetries, err)
+		}
+
+		delay := reconnectDelay(attempt)
+		fmt.Fprintln(stderr, Yellow(fmt.Sprintf("Session closed, reconnecting in %s (attempt %d of %d)", delay, attempt, maxRetries)))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+
+		e.forwardMu.Lock()
+		err = e.refreshForwardTarget(stdout)
+		e.forwardMu.Unlock()
+		if err != nil {
+			fmt.Fprintln(stderr, Red(err))
+		}
+	}
+}
+
+// reconnectDelay returns the exponential backoff delay for the given attempt
+func reconnectDelay(attempt int) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempt && delay < maxReconnectDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxReconnectDelay {
+		delay = maxReconnectDelay
+	}
+
+	return delay
+}
+
+// refreshForwardTarget checks that the task we're forwarding to is still running, and if it isn't finds
+// a healthy task in the same service running the same container to replace it
+func (e *App) refreshForwardTarget(w io.Writer) error {
+	containerName := *e.container.Name
+
+	describe, err := e.client.DescribeTasks(context.TODO(), &ecs.DescribeTasksInput{
+		Cluster: aws.String(e.cluster),
+		Tasks:   []string{*e.task.TaskArn},
+	})
+	if err == nil && len(describe.Tasks) > 0 && healthyContainer(&describe.Tasks[0], containerName) != nil {
+		return nil
+	}
+
+	if e.service == "" || e.service == "*" || e.service == standaloneTasks {
+		return fmt.Errorf("task %s is no longer running and there is no service to find a replacement in", *e.task.TaskArn)
+	}
+
+	taskArns, err := listTaskArns(e.client, &ecs.ListTasksInput{
+		Cluster:       aws.String(e.cluster),
+		ServiceName:   aws.String(e.service),
+		DesiredStatus: ecsTypes.DesiredStatusRunning,
+		MaxResults:    awsMaxResults,
+	})
+	if err != nil {
+		return err
+	}
+	if len(taskArns) == 0 {
+		return fmt.Errorf("no running tasks found for the service %s in cluster %s", e.service, e.cluster)
+	}
+
+	tasks, err := describeTasks(e.client, e.cluster, taskArns, nil)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		task := t
+		if container := healthyContainer(&task, containerName); container != nil {
+			e.task = &task
+			e.container = container
+			fmt.Fprintf(w, "Switching to replacement task %s\n", Green(*task.TaskArn))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no healthy tasks running container %s found for the service %s in cluster %s", containerName, e.service, e.cluster)
+}
+
+// healthyContainer returns the named container if both it and the task are running and the task isn't
+// unhealthy, otherwise nil
+func healthyContainer(task *ecsTypes.Task, containerName string) *ecsTypes.Container {
+	if aws.ToString(task.LastStatus) != "RUNNING" || task.HealthStatus == ecsTypes.HealthStatusUnhealthy {
+		return nil
+	}
+	for _, c := range task.Containers {
+		container := c
+		if aws.ToString(container.Name) == containerName && aws.ToString(container.LastStatus) == "RUNNING" && container.RuntimeId != nil {
+			return &container
+		}
+	}
+
+	return nil
+}
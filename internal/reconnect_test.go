@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconnectDelay(t *testing.T) {
+	assert.Equal(t, time.Second, reconnectDelay(1))
+	assert.Equal(t, 2*time.Second, reconnectDelay(2))
+	assert.Equal(t, 16*time.Second, reconnectDelay(5))
+	assert.Equal(t, maxReconnectDelay, reconnectDelay(10))
+}
+
+func TestRefreshForwardTarget(t *testing.T) {
+	tasks := map[string]ecsTypes.Task{
+		"old": {
+			TaskArn:    aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/old"),
+			LastStatus: aws.String("STOPPED"),
+		},
+		"unhealthy": {
+			TaskArn:      aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/unhealthy"),
+			LastStatus:   aws.String("RUNNING"),
+			HealthStatus: ecsTypes.HealthStatusUnhealthy,
+			Containers: []ecsTypes.Container{
+				{Name: aws.String("nginx"), LastStatus: aws.String("RUNNING"), RuntimeId: aws.String("unhealthy-nginx")},
+			},
+		},
+		"new": {
+			TaskArn:      aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/new"),
+			LastStatus:   aws.String("RUNNING"),
+			HealthStatus: ecsTypes.HealthStatusHealthy,
+			Containers: []ecsTypes.Container{
+				{Name: aws.String("sidecar"), LastStatus: aws.String("RUNNING"), RuntimeId: aws.String("new-sidecar")},
+				{Name: aws.String("nginx"), LastStatus: aws.String("RUNNING"), RuntimeId: aws.String("new-nginx")},
+			},
+		},
+	}
+
+	// A large service, where the only healthy task is beyond the first 100
+	var busy []string
+	for i := 0; i < 150; i++ {
+		busy = append(busy, fmt.Sprintf("arn:aws:ecs:eu-west-1:111111111111:task/App/busy-%d", i))
+	}
+
+	cases := []struct {
+		name        string
+		service     string
+		serviceArns []string
+		expected    string
+		err         bool
+	}{
+		{
+			name:        "TestRefreshForwardTargetFindsReplacement",
+			service:     "nginx",
+			serviceArns: []string{"arn:aws:ecs:eu-west-1:111111111111:task/App/unhealthy", "arn:aws:ecs:eu-west-1:111111111111:task/App/new"},
+			expected:    "new-nginx",
+		},
+		{
+			name:        "TestRefreshForwardTargetLargeService",
+			service:     "nginx",
+			serviceArns: append(busy, "arn:aws:ecs:eu-west-1:111111111111:task/App/new"),
+			expected:    "new-nginx",
+		},
+		{
+			name:        "TestRefreshForwardTargetNoHealthyTasks",
+			service:     "nginx",
+			serviceArns: []string{"arn:aws:ecs:eu-west-1:111111111111:task/App/unhealthy"},
+			err:         true,
+		},
+		{
+			name:    "TestRefreshForwardTargetWithoutService",
+			service: "",
+			err:     true,
+		},
+	}
+
+	for _, c := range cases {
+		client := ECSClientMock{
+			ListTasksMock: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+				assert.Equal(t, c.service, *input.ServiceName)
+				return &ecs.ListTasksOutput{TaskArns: c.serviceArns}, nil
+			},
+			DescribeTasksMock: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+				assert.True(t, len(input.Tasks) <= 100)
+				var res []ecsTypes.Task
+				for _, arn := range input.Tasks {
+					task, ok := tasks[arn[len("arn:aws:ecs:eu-west-1:111111111111:task/App/"):]]
+					if !ok {
+						task = ecsTypes.Task{TaskArn: aws.String(arn), LastStatus: aws.String("PROVISIONING")}
+					}
+					res = append(res, task)
+				}
+				return &ecs.DescribeTasksOutput{Tasks: res}, nil
+			},
+		}
+		app := CreateMockApp(client)
+		app.cluster = "App"
+		app.service = c.service
+		old := tasks["old"]
+		app.task = &old
+		app.container = &ecsTypes.Container{Name: aws.String("nginx"), RuntimeId: aws.String("old-nginx")}
+
+		err := app.refreshForwardTarget(io.Discard)
+		if ok := assert.Equal(t, c.err, err != nil); ok != true {
+			fmt.Printf("%s FAILED\n", c.name)
+		}
+		if !c.err {
+			if ok := assert.Equal(t, c.expected, *app.container.RuntimeId); ok != true {
+				fmt.Printf("%s FAILED\n", c.name)
+			}
+		}
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+}
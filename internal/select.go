@@ -3,16 +3,42 @@
 package app
 
 import (
-	"flag"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/terminal"
 	"github.com/aws/aws-sdk-go-v2/aws"
 
 	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
 )
 
+var (
+	// errBack is returned by a Prompter when the user chooses to go back to the previous prompt
+	errBack = errors.New("back")
+	// ErrCancelled is returned when the user cancels a prompt with Ctrl-C
+	ErrCancelled = errors.New("cancelled")
+)
+
+// Prompter asks the user to choose between the resources found at each step, or to enter values which
+// weren't given as flags. Select prompts which offer a Back option return errBack when it's chosen.
+type Prompter interface {
+	SelectCluster(labels []string, clusters []ecsTypes.Cluster) (int, error)
+	SelectService(services []ecsTypes.Service) (string, error)
+	SelectTask(tasks map[string]*ecsTypes.Task, requireExec bool) (*ecsTypes.Task, error)
+	SelectContainer(containers []ecsTypes.Container) (*ecsTypes.Container, error)
+	SelectPorts(ports []int32) ([]int32, error)
+	InputLocalPort(defaultPort string) (string, error)
+	InputRemotePort(host string) (string, error)
+	InputMFAToken(serial string) (string, error)
+}
+
+// surveyPrompter prompts the user in the terminal
+type surveyPrompter struct{}
+
 func init() {
 	survey.SelectQuestionTemplate = `
 	{{- if .ShowHelp }}{{- color .Config.Icons.Help.Format }}{{ .Config.Icons.Help.Text }} {{ .Help }}{{color "reset"}}{{"\n"}}{{end}}
@@ -35,166 +61,488 @@ func createOpts(opts []string) []string {
 	return append(initialOpts, opts...)
 }
 
-// selectCluster provides the prompt for choosing a cluster
-func selectCluster(clusterNames []string) (string, error) {
-	if flag.Lookup("test.v") != nil {
-		if len(clusterNames) > 100 {
-			// For Pagination testing, after sorting alphabetically, the 101st cluster is at index 4, and proves
-			// that the pagination is working correctly
-			return clusterNames[4], nil
-		}
-		return clusterNames[0], nil
+// ask shows the prompt, translating Ctrl-C into ErrCancelled
+func ask(prompt survey.Prompt, response interface{}, opts ...survey.AskOpt) error {
+	err := survey.AskOne(prompt, response, opts...)
+	if errors.Is(err, terminal.InterruptErr) {
+		return ErrCancelled
 	}
+	return err
+}
+
+// withFocusIcon sets the icon shown next to the focused option
+func withFocusIcon(format string) survey.AskOpt {
+	return survey.WithIcons(func(icons *survey.IconSet) {
+		icons.SelectFocus.Text = "➡"
+		icons.SelectFocus.Format = format
+	})
+}
 
+// SelectCluster provides the prompt for choosing a cluster, returning the index of the selected cluster. Each
+// cluster is shown by its label along with its status, task and service counts, container instances and
+// capacity providers.
+func (surveyPrompter) SelectCluster(labels []string, clusters []ecsTypes.Cluster) (int, error) {
 	prompt := &survey.Select{
 		Message:  "Select a cluster:",
-		Options:  clusterNames,
+		Options:  formatClusters(labels, clusters),
 		PageSize: pageSize,
 	}
 
-	var selection string
-	err := survey.AskOne(prompt, &selection, survey.WithIcons(func(icons *survey.IconSet) {
-		icons.SelectFocus.Text = "➡"
-		icons.SelectFocus.Format = "cyan"
-	}))
-	if err != nil {
-		return "", err
+	var selection int
+	if err := ask(prompt, &selection, withFocusIcon("cyan")); err != nil {
+		return 0, err
 	}
 
 	return selection, nil
 }
 
-// selectService provides the prompt for choosing a service
-func selectService(serviceNames []string) (string, error) {
-	if flag.Lookup("test.v") != nil {
-		if len(serviceNames) > int(*awsMaxResults) {
-			// For Pagination testing, after sorting alphabetically, the 101st service is at index 4, and proves
-			// that the pagination is working correctly
-			return serviceNames[4], nil
+// SelectService provides the prompt for choosing a service. Each service is shown with its task counts,
+// deployment status, launch type and whether ECS Exec is enabled, and services scaled to zero are greyed out.
+// The services are followed by entries for the standalone tasks in the cluster and for all tasks (*).
+func (surveyPrompter) SelectService(services []ecsTypes.Service) (string, error) {
+	prompt := &survey.Select{
+		Message:  fmt.Sprintf("Select a service: %s", Yellow("(choose * to display all tasks)")),
+		Options:  createOpts(append(formatServices(services), standaloneTasks, "*")),
+		PageSize: pageSize,
+	}
+
+	var selection int
+	if err := ask(prompt, &selection, withFocusIcon("magenta")); err != nil {
+		return "", err
+	}
+	switch selection {
+	case 0:
+		return "", errBack
+	case len(services) + 1:
+		return standaloneTasks, nil
+	case len(services) + 2:
+		return "*", nil
+	}
+
+	return aws.ToString(services[selection-1].ServiceName), nil
+}
+
+// SelectTask provides the prompt for choosing a Task. Tasks without ECS Exec enabled are shown greyed out, and
+// when requireExec is set the user is prompted again if one of them is chosen.
+func (surveyPrompter) SelectTask(tasks map[string]*ecsTypes.Task, requireExec bool) (*ecsTypes.Task, error) {
+	sorted := sortTasks(tasks)
+	prompt := &survey.Select{
+		Message:  "Select a task:",
+		Options:  createOpts(formatTasks(sorted, time.Now())),
+		PageSize: pageSize,
+	}
+
+	for {
+		var selection int
+		if err := ask(prompt, &selection, withFocusIcon("green")); err != nil {
+			return nil, err
+		}
+		if selection == 0 {
+			return nil, errBack
+		}
+
+		task := sorted[selection-1]
+		if requireExec && !task.EnableExecuteCommand {
+			fmt.Println(Yellow(fmt.Sprintf("ECS Exec is not enabled for task %s, please select another task", taskID(task))))
+			continue
 		}
-		return serviceNames[0], nil
+
+		return task, nil
 	}
+}
 
-	serviceNames = append(serviceNames, "*")
+// SelectContainer prompts the user to choose a container within a task
+func (surveyPrompter) SelectContainer(containers []ecsTypes.Container) (*ecsTypes.Container, error) {
+	var containerNames []string
+	for _, c := range containers {
+		containerNames = append(containerNames, *c.Name)
+	}
 
 	prompt := &survey.Select{
-		Message:  fmt.Sprintf("Select a service: %s", Yellow("(choose * to display all tasks)")),
-		Options:  createOpts(serviceNames),
+		Message:  "Multiple containers found, please select:",
+		Options:  createOpts(containerNames),
 		PageSize: pageSize,
 	}
 
-	var selection string
-	err := survey.AskOne(prompt, &selection, survey.WithIcons(func(icons *survey.IconSet) {
-		icons.SelectFocus.Text = "➡"
-		icons.SelectFocus.Format = "magenta"
+	var selection int
+	if err := ask(prompt, &selection, withFocusIcon("yellow")); err != nil {
+		return nil, err
+	}
+	if selection == 0 {
+		return nil, errBack
+	}
+	container := containers[selection-1]
+
+	return &container, nil
+}
+
+// SelectPorts prompts the user to choose one or more of the container's mapped ports to forward
+func (surveyPrompter) SelectPorts(ports []int32) ([]int32, error) {
+	var portOpts []string
+	for _, p := range ports {
+		portOpts = append(portOpts, fmt.Sprint(p))
+	}
+
+	var selection []int
+	prompt := &survey.MultiSelect{
+		Message:  "Select the container ports to forward:",
+		Options:  portOpts,
+		PageSize: pageSize,
+	}
+	if err := ask(prompt, &selection, survey.WithValidator(survey.Required), withFocusIcon("yellow")); err != nil {
+		return nil, err
+	}
+
+	var selected []int32
+	for _, i := range selection {
+		selected = append(selected, ports[i])
+	}
+
+	return selected, nil
+}
+
+// InputLocalPort prompts the user to enter a port number for port-forwarding, offering the remote port as the default
+func (surveyPrompter) InputLocalPort(defaultPort string) (string, error) {
+	port := ""
+	prompt := &survey.Input{
+		Message: fmt.Sprintf("Enter the local port to be used for forwarding to %s (0 picks a free port)\n", defaultPort),
+		Default: defaultPort,
+	}
+	err := ask(prompt, &port, survey.WithValidator(func(ans interface{}) error {
+		// The port is only allocated once the prompt is answered, so that a free port is picked just once
+		_, err := validateLocalPort(ans.(string))
+		return err
 	}))
 	if err != nil {
 		return "", err
 	}
 
-	return selection, nil
+	return port, nil
+}
+
+// InputRemotePort prompts the user to enter the port on the remote host to forward to
+func (surveyPrompter) InputRemotePort(host string) (string, error) {
+	port := ""
+	prompt := &survey.Input{
+		Message: fmt.Sprintf("Enter the port on %s to forward to\n", host),
+	}
+	if err := ask(prompt, &port); err != nil {
+		return "", err
+	}
+
+	return port, nil
+}
+
+// InputMFAToken prompts the user to enter the current code from their MFA device
+func (surveyPrompter) InputMFAToken(serial string) (string, error) {
+	token := ""
+	prompt := &survey.Input{
+		Message: fmt.Sprintf("Enter the MFA code for %s\n", serial),
+	}
+	if err := ask(prompt, &token, survey.WithValidator(survey.Required)); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(token), nil
 }
 
-// selectTask provides the prompt for choosing a Task
-func selectTask(tasks map[string]*ecsTypes.Task) (*ecsTypes.Task, error) {
-	if flag.Lookup("test.v") != nil {
-		// When testing pagination, we want to return a task from the second set of results,
-		// which will prove pagination is working correctly
-		if len(tasks) > int(*awsMaxResults) {
-			return tasks["199"], nil
+// sortTasks orders tasks by their group (see taskGroup), then by the time they started, oldest first, and then
+// by ID. Tasks which haven't started yet are listed last within their group.
+func sortTasks(tasks map[string]*ecsTypes.Task) []*ecsTypes.Task {
+	var sorted []*ecsTypes.Task
+	for _, t := range tasks {
+		sorted = append(sorted, t)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if a, b := taskGroup(sorted[i]), taskGroup(sorted[j]); a != b {
+			return a < b
+		}
+		a, b := sorted[i].StartedAt, sorted[j].StartedAt
+		switch {
+		case a != nil && b != nil && !a.Equal(*b):
+			return a.Before(*b)
+		case a != nil && b == nil:
+			return true
+		case a == nil && b != nil:
+			return false
 		}
-		for _, t := range tasks {
-			return t, nil // return the first value from the map
+		return taskID(sorted[i]) < taskID(sorted[j])
+	})
+
+	return sorted
+}
+
+// formatTasks renders each task as a row of aligned columns for the task picker. When any of the tasks are
+// standalone, each row starts with the task's group so tasks started the same way are shown together.
+func formatTasks(tasks []*ecsTypes.Task, now time.Time) []string {
+	var grouped bool
+	for _, t := range tasks {
+		if isStandalone(t) {
+			grouped = true
 		}
 	}
 
-	var taskOpts []string
-	for id, t := range tasks {
-		taskDefinition := strings.Split(*t.TaskDefinitionArn, "/")[1]
+	var rows [][]string
+	var widths []int
+	for _, t := range tasks {
 		var containers []string
 		for _, c := range t.Containers {
-			containers = append(containers, *c.Name)
+			containers = append(containers, aws.ToString(c.Name))
 		}
-		taskOpts = append(taskOpts, fmt.Sprintf("%s | %s | (%s)", id, taskDefinition, strings.Join(containers, ",")))
+		uptime := "-"
+		if t.StartedAt != nil {
+			uptime = formatUptime(now.Sub(*t.StartedAt))
+		}
+		exec := "no exec"
+		if t.EnableExecuteCommand {
+			exec = "exec"
+		}
+		row := []string{
+			taskID(t),
+			taskDefinitionName(t),
+			valueOrDash(aws.ToString(t.LastStatus)),
+			valueOrDash(string(t.HealthStatus)),
+			valueOrDash(aws.ToString(t.AvailabilityZone)),
+			valueOrDash(taskPrivateIP(t)),
+			uptime,
+			fmt.Sprintf("%s/%s", valueOrDash(aws.ToString(t.Cpu)), valueOrDash(aws.ToString(t.Memory))),
+			exec,
+		}
+		if grouped {
+			row = append([]string{valueOrDash(taskGroup(t))}, row...)
+		}
+		if widths == nil {
+			widths = make([]int, len(row))
+		}
+		for i, column := range row {
+			if len(column) > widths[i] {
+				widths[i] = len(column)
+			}
+		}
+		rows = append(rows, append(row, fmt.Sprintf("(%s)", strings.Join(containers, ","))))
 	}
 
-	prompt := &survey.Select{
-		Message:  "Select a task:",
-		Options:  createOpts(taskOpts),
-		PageSize: pageSize,
+	var opts []string
+	for i, row := range rows {
+		for j := range widths {
+			row[j] = fmt.Sprintf("%-*s", widths[j], row[j])
+		}
+		opt := strings.Join(row, " | ")
+		if !tasks[i].EnableExecuteCommand {
+			opt = Grey(opt)
+		}
+		opts = append(opts, opt)
 	}
 
-	var selection string
-	err := survey.AskOne(prompt, &selection, survey.WithIcons(func(icons *survey.IconSet) {
-		icons.SelectFocus.Text = "➡"
-		icons.SelectFocus.Format = "green"
-	}))
-	if err != nil {
-		return &ecsTypes.Task{}, err
+	return opts
+}
+
+// isStandalone reports whether the task was started outside of a service, e.g. by an EventBridge schedule, a
+// Step Functions state machine or run-task
+func isStandalone(t *ecsTypes.Task) bool {
+	group := aws.ToString(t.Group)
+	return group != "" && !strings.HasPrefix(group, "service:")
+}
+
+// taskGroup returns the group a task is listed under. Service tasks are grouped by their service (service:name),
+// and standalone tasks by what started them, falling back to their task group (family:name unless overridden).
+func taskGroup(t *ecsTypes.Task) string {
+	if startedBy := aws.ToString(t.StartedBy); isStandalone(t) && startedBy != "" {
+		return startedBy
 	}
+	return aws.ToString(t.Group)
+}
 
-	if selection == backOpt {
-		return &ecsTypes.Task{TaskArn: aws.String(backOpt)}, nil
+// formatClusters renders each cluster as a row of aligned columns for the cluster picker
+func formatClusters(labels []string, clusters []ecsTypes.Cluster) []string {
+	var rows [][]string
+	widths := make([]int, 6)
+	for i, c := range clusters {
+		row := []string{
+			labels[i],
+			valueOrDash(aws.ToString(c.Status)),
+			fmt.Sprintf("%d running, %d pending", c.RunningTasksCount, c.PendingTasksCount),
+			fmt.Sprintf("%d services", c.ActiveServicesCount),
+			fmt.Sprintf("%d instances", c.RegisteredContainerInstancesCount),
+			valueOrDash(strings.Join(c.CapacityProviders, ",")),
+		}
+		for j, column := range row {
+			if len(column) > widths[j] {
+				widths[j] = len(column)
+			}
+		}
+		rows = append(rows, row)
 	}
 
-	taskId := strings.Split(selection, " | ")[0]
-	task := tasks[taskId]
+	var opts []string
+	for i, row := range rows {
+		for j := range widths {
+			row[j] = fmt.Sprintf("%-*s", widths[j], row[j])
+		}
+		opt := strings.TrimRight(strings.Join(row, " | "), " ")
+		if aws.ToString(clusters[i].Status) == "INACTIVE" {
+			opt = Grey(opt)
+		}
+		opts = append(opts, opt)
+	}
 
-	return task, nil
+	return opts
 }
 
-// selectContainer prompts the user to choose a container within a task
-func selectContainer(containers *[]ecsTypes.Container) (*ecsTypes.Container, error) {
-	if flag.Lookup("test.v") != nil {
-		container := *containers
-		return &container[0], nil
+// formatServices renders each service as a row of aligned columns for the service picker
+func formatServices(services []ecsTypes.Service) []string {
+	var rows [][]string
+	widths := make([]int, 5)
+	for _, s := range services {
+		exec := "no exec"
+		if s.EnableExecuteCommand {
+			exec = "exec"
+		}
+		row := []string{
+			aws.ToString(s.ServiceName),
+			fmt.Sprintf("%d running, %d desired, %d pending", s.RunningCount, s.DesiredCount, s.PendingCount),
+			deploymentStatus(s),
+			valueOrDash(serviceLaunchType(s)),
+			exec,
+		}
+		for i, column := range row {
+			if len(column) > widths[i] {
+				widths[i] = len(column)
+			}
+		}
+		rows = append(rows, row)
 	}
 
-	var containerNames []string
-	for _, c := range *containers {
-		containerNames = append(containerNames, *c.Name)
+	var opts []string
+	for i, row := range rows {
+		for j := range widths {
+			row[j] = fmt.Sprintf("%-*s", widths[j], row[j])
+		}
+		opt := strings.TrimRight(strings.Join(row, " | "), " ")
+		if services[i].DesiredCount == 0 && services[i].RunningCount == 0 {
+			opt = Grey(opt)
+		}
+		opts = append(opts, opt)
 	}
 
-	var selection string
-	var prompt = &survey.Select{
-		Message:  "Multiple containers found, please select:",
-		Options:  createOpts(containerNames),
-		PageSize: pageSize,
+	return opts
+}
+
+// deploymentStatus summarises the deployments of a service. A service is rolling while it has ACTIVE
+// deployments alongside the PRIMARY one, or while the PRIMARY deployment hasn't completed.
+func deploymentStatus(s ecsTypes.Service) string {
+	var primary *ecsTypes.Deployment
+	var active, activeRunning int32
+	for i, d := range s.Deployments {
+		switch aws.ToString(d.Status) {
+		case "PRIMARY":
+			primary = &s.Deployments[i]
+		case "ACTIVE":
+			active++
+			activeRunning += d.RunningCount
+		}
+	}
+	if primary == nil {
+		return "-"
 	}
 
-	err := survey.AskOne(prompt, &selection, survey.WithIcons(func(icons *survey.IconSet) {
-		icons.SelectFocus.Text = "➡"
-		icons.SelectFocus.Format = "yellow"
-	}))
-	if err != nil {
-		return &ecsTypes.Container{}, err
+	switch {
+	case primary.RolloutState == ecsTypes.DeploymentRolloutStateFailed:
+		return "failed"
+	case active == 0 && primary.RolloutState != ecsTypes.DeploymentRolloutStateInProgress:
+		return "steady"
+	case active == 0:
+		return fmt.Sprintf("rolling (PRIMARY %d/%d)", primary.RunningCount, primary.DesiredCount)
+	default:
+		return fmt.Sprintf("rolling (PRIMARY %d/%d, ACTIVE %d)", primary.RunningCount, primary.DesiredCount, activeRunning)
+	}
+}
+
+// serviceLaunchType returns the launch type of the service, or its capacity providers when it uses a
+// capacity provider strategy instead
+func serviceLaunchType(s ecsTypes.Service) string {
+	if s.LaunchType != "" {
+		return string(s.LaunchType)
+	}
+	var providers []string
+	for _, p := range s.CapacityProviderStrategy {
+		providers = append(providers, aws.ToString(p.CapacityProvider))
 	}
-	if selection == backOpt {
-		return &ecsTypes.Container{Name: aws.String(backOpt)}, nil
+	return strings.Join(providers, ",")
+}
+
+// taskID returns the ID from the task ARN
+func taskID(t *ecsTypes.Task) string {
+	arn := aws.ToString(t.TaskArn)
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
+
+// taskDefinitionName returns the family and revision of the task definition the task is running
+func taskDefinitionName(t *ecsTypes.Task) string {
+	family, revision := splitTaskDefinition(aws.ToString(t.TaskDefinitionArn))
+	if revision == "" {
+		return family
 	}
+	return fmt.Sprintf("%s:%s", family, revision)
+}
 
-	var container *ecsTypes.Container
-	for _, c := range *containers {
-		cont := c
-		if selection == *cont.Name {
-			container = &cont
+// taskPrivateIP returns the private IP of the task, from its ENI attachment when using awsvpc networking or
+// otherwise from the network interfaces of its containers
+func taskPrivateIP(t *ecsTypes.Task) string {
+	for _, a := range t.Attachments {
+		for _, d := range a.Details {
+			if aws.ToString(d.Name) == "privateIPv4Address" {
+				return aws.ToString(d.Value)
+			}
 		}
 	}
+	for _, c := range t.Containers {
+		for _, n := range c.NetworkInterfaces {
+			if n.PrivateIpv4Address != nil {
+				return *n.PrivateIpv4Address
+			}
+		}
+	}
+	return ""
+}
+
+// formatUptime renders a duration in its two most significant units, e.g. 3d4h or 2h15m
+func formatUptime(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dd%dh", int(d.Hours())/24, int(d.Hours())%24)
+	}
+}
 
-	return container, nil
+func valueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
 }
 
-// inputLocalPort prompts the user to enter a port number for port-forwarding
-func inputLocalPort() (string, error) {
-	if flag.Lookup("test.v") != nil {
-		return "42069", nil
+// SelectHistory prompts the user to choose a recent connection to reconnect to
+func SelectHistory(history []HistoryEntry) (HistoryEntry, error) {
+	var opts []string
+	for _, h := range history {
+		opts = append(opts, h.String())
 	}
 
-	port := ""
-	prompt := &survey.Input{
-		Message: "Enter the local port to be used for forwarding\n",
+	var selection int
+	prompt := &survey.Select{
+		Message:  "Select a recent connection:",
+		Options:  opts,
+		PageSize: pageSize,
+	}
+	if err := ask(prompt, &selection, withFocusIcon("cyan")); err != nil {
+		return HistoryEntry{}, err
 	}
-	survey.AskOne(prompt, &port)
 
-	return port, nil
+	return history[selection], nil
 }
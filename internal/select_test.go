@@ -0,0 +1,234 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortTasks(t *testing.T) {
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	earlier := started.Add(-time.Hour)
+	tasks := map[string]*ecsTypes.Task{
+		"c": {TaskArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/c"), StartedAt: &started},
+		"b": {TaskArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/b"), StartedAt: &started},
+		"d": {TaskArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/d"), StartedAt: &earlier},
+		"a": {TaskArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/a")},
+	}
+
+	// The order must be the same every time, regardless of map iteration order
+	for i := 0; i < 10; i++ {
+		var ids []string
+		for _, task := range sortTasks(tasks) {
+			ids = append(ids, taskID(task))
+		}
+		assert.Equal(t, []string{"d", "b", "c", "a"}, ids)
+	}
+}
+
+func TestGroupStandaloneTasks(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	started := now.Add(-5 * time.Minute)
+	tasks := map[string]*ecsTypes.Task{
+		"a": {
+			TaskArn:           aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/a"),
+			TaskDefinitionArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/api:1"),
+			Group:             aws.String("service:api"),
+			StartedBy:         aws.String("ecs-svc/1234"),
+		},
+		"b": {
+			TaskArn:           aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/b"),
+			TaskDefinitionArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/report:3"),
+			Group:             aws.String("family:report"),
+			StartedBy:         aws.String("events-rule/nightly-report"),
+			StartedAt:         &started,
+		},
+		"c": {
+			TaskArn:           aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/c"),
+			TaskDefinitionArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/migrate:7"),
+			Group:             aws.String("family:migrate"),
+		},
+	}
+
+	assert.False(t, isStandalone(tasks["a"]))
+	assert.True(t, isStandalone(tasks["b"]))
+	assert.Equal(t, "service:api", taskGroup(tasks["a"]))
+	assert.Equal(t, "events-rule/nightly-report", taskGroup(tasks["b"]))
+	assert.Equal(t, "family:migrate", taskGroup(tasks["c"]))
+
+	sorted := sortTasks(tasks)
+	var ids []string
+	for _, task := range sorted {
+		ids = append(ids, taskID(task))
+	}
+	assert.Equal(t, []string{"b", "c", "a"}, ids)
+
+	opts := formatTasks(sorted, now)
+	assert.Equal(t, Grey("events-rule/nightly-report | b | report:3  | - | - | - | - | 5m | -/- | no exec | ()"), opts[0])
+	assert.Equal(t, Grey("family:migrate             | c | migrate:7 | - | - | - | - | -  | -/- | no exec | ()"), opts[1])
+	assert.Equal(t, Grey("service:api                | a | api:1     | - | - | - | - | -  | -/- | no exec | ()"), opts[2])
+}
+
+func TestFormatTasks(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	started := now.Add(-(2*time.Hour + 15*time.Minute))
+	tasks := []*ecsTypes.Task{
+		{
+			TaskArn:              aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/8a58117dac38436ba5547e9da5d3ac3d"),
+			TaskDefinitionArn:    aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/api:42"),
+			LastStatus:           aws.String("RUNNING"),
+			HealthStatus:         ecsTypes.HealthStatusHealthy,
+			AvailabilityZone:     aws.String("eu-west-1a"),
+			StartedAt:            &started,
+			Cpu:                  aws.String("256"),
+			Memory:               aws.String("512"),
+			EnableExecuteCommand: true,
+			Attachments: []ecsTypes.Attachment{{Details: []ecsTypes.KeyValuePair{
+				{Name: aws.String("subnetId"), Value: aws.String("subnet-1")},
+				{Name: aws.String("privateIPv4Address"), Value: aws.String("10.0.1.25")},
+			}}},
+			Containers: []ecsTypes.Container{{Name: aws.String("api")}, {Name: aws.String("envoy")}},
+		},
+		{
+			TaskArn:           aws.String("arn:aws:ecs:eu-west-1:111111111111:task/App/1"),
+			TaskDefinitionArn: aws.String("arn:aws:ecs:eu-west-1:111111111111:task-definition/worker:3"),
+			LastStatus:        aws.String("PENDING"),
+			Containers: []ecsTypes.Container{{
+				Name:              aws.String("worker"),
+				NetworkInterfaces: []ecsTypes.NetworkInterface{{PrivateIpv4Address: aws.String("10.0.2.7")}},
+			}},
+		},
+	}
+
+	opts := formatTasks(tasks, now)
+	assert.Equal(t, "8a58117dac38436ba5547e9da5d3ac3d | api:42   | RUNNING | HEALTHY | eu-west-1a | 10.0.1.25 | 2h15m | 256/512 | exec    | (api,envoy)", opts[0])
+	assert.Equal(t, Grey("1                                | worker:3 | PENDING | -       | -          | 10.0.2.7  | -     | -/-     | no exec | (worker)"), opts[1])
+}
+
+func TestFormatClusters(t *testing.T) {
+	clusters := []ecsTypes.Cluster{
+		{
+			Status:                            aws.String("ACTIVE"),
+			RunningTasksCount:                 12,
+			PendingTasksCount:                 1,
+			ActiveServicesCount:               4,
+			RegisteredContainerInstancesCount: 3,
+			CapacityProviders:                 []string{"FARGATE", "FARGATE_SPOT"},
+		},
+		{Status: aws.String("INACTIVE")},
+	}
+
+	opts := formatClusters([]string{"App", "old-cluster"}, clusters)
+	assert.Equal(t, "App         | ACTIVE   | 12 running, 1 pending | 4 services | 3 instances | FARGATE,FARGATE_SPOT", opts[0])
+	assert.Equal(t, Grey("old-cluster | INACTIVE | 0 running, 0 pending  | 0 services | 0 instances | -"), opts[1])
+}
+
+func TestFormatServices(t *testing.T) {
+	services := []ecsTypes.Service{
+		{
+			ServiceName:          aws.String("api"),
+			RunningCount:         3,
+			DesiredCount:         3,
+			LaunchType:           ecsTypes.LaunchTypeFargate,
+			EnableExecuteCommand: true,
+			Deployments: []ecsTypes.Deployment{
+				{Status: aws.String("PRIMARY"), RolloutState: ecsTypes.DeploymentRolloutStateCompleted, RunningCount: 3, DesiredCount: 3},
+			},
+		},
+		{
+			ServiceName:  aws.String("worker"),
+			RunningCount: 2,
+			DesiredCount: 2,
+			PendingCount: 1,
+			CapacityProviderStrategy: []ecsTypes.CapacityProviderStrategyItem{
+				{CapacityProvider: aws.String("FARGATE")}, {CapacityProvider: aws.String("FARGATE_SPOT")},
+			},
+			Deployments: []ecsTypes.Deployment{
+				{Status: aws.String("PRIMARY"), RolloutState: ecsTypes.DeploymentRolloutStateInProgress, RunningCount: 1, DesiredCount: 2},
+				{Status: aws.String("ACTIVE"), RunningCount: 1},
+			},
+		},
+		{
+			ServiceName: aws.String("cron"),
+			LaunchType:  ecsTypes.LaunchTypeEc2,
+			Deployments: []ecsTypes.Deployment{{Status: aws.String("PRIMARY")}},
+		},
+	}
+
+	opts := formatServices(services)
+	assert.Equal(t, "api    | 3 running, 3 desired, 0 pending | steady                          | FARGATE              | exec", opts[0])
+	assert.Equal(t, "worker | 2 running, 2 desired, 1 pending | rolling (PRIMARY 1/2, ACTIVE 1) | FARGATE,FARGATE_SPOT | no exec", opts[1])
+	assert.Equal(t, Grey("cron   | 0 running, 0 desired, 0 pending | steady                          | EC2                  | no exec"), opts[2])
+}
+
+func TestDeploymentStatus(t *testing.T) {
+	cases := []struct {
+		name        string
+		deployments []ecsTypes.Deployment
+		expected    string
+	}{
+		{
+			name:     "TestDeploymentStatusNone",
+			expected: "-",
+		},
+		{
+			name: "TestDeploymentStatusSteady",
+			deployments: []ecsTypes.Deployment{
+				{Status: aws.String("PRIMARY"), RolloutState: ecsTypes.DeploymentRolloutStateCompleted},
+			},
+			expected: "steady",
+		},
+		{
+			name: "TestDeploymentStatusInProgress",
+			deployments: []ecsTypes.Deployment{
+				{Status: aws.String("PRIMARY"), RolloutState: ecsTypes.DeploymentRolloutStateInProgress, RunningCount: 1, DesiredCount: 4},
+			},
+			expected: "rolling (PRIMARY 1/4)",
+		},
+		{
+			name: "TestDeploymentStatusRolling",
+			deployments: []ecsTypes.Deployment{
+				{Status: aws.String("PRIMARY"), RunningCount: 2, DesiredCount: 4},
+				{Status: aws.String("ACTIVE"), RunningCount: 1},
+				{Status: aws.String("ACTIVE"), RunningCount: 2},
+				{Status: aws.String("INACTIVE"), RunningCount: 0},
+			},
+			expected: "rolling (PRIMARY 2/4, ACTIVE 3)",
+		},
+		{
+			name: "TestDeploymentStatusFailed",
+			deployments: []ecsTypes.Deployment{
+				{Status: aws.String("PRIMARY"), RolloutState: ecsTypes.DeploymentRolloutStateFailed},
+				{Status: aws.String("ACTIVE"), RunningCount: 2},
+			},
+			expected: "failed",
+		},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, deploymentStatus(ecsTypes.Service{Deployments: c.deployments}), c.name)
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+}
+
+func TestFormatUptime(t *testing.T) {
+	cases := []struct {
+		name     string
+		duration time.Duration
+		expected string
+	}{
+		{name: "TestFormatUptimeSeconds", duration: 42 * time.Second, expected: "42s"},
+		{name: "TestFormatUptimeMinutes", duration: 5*time.Minute + 30*time.Second, expected: "5m"},
+		{name: "TestFormatUptimeHours", duration: 2*time.Hour + 15*time.Minute, expected: "2h15m"},
+		{name: "TestFormatUptimeDays", duration: 76 * time.Hour, expected: "3d4h"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, formatUptime(c.duration), c.name)
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+}
@@ -0,0 +1,525 @@
+/* session.go contains a native implementation of the SSM session data channel protocol, which allows us to
+connect to execute-command sessions without the session-manager-plugin */
+
+package app
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/gorilla/websocket"
+	"golang.org/x/term"
+)
+
+const (
+	sessionClientVersion = "1.2.0.0"
+
+	// Message types used on the data channel
+	inputStreamMessage  = "input_stream_data"
+	outputStreamMessage = "output_stream_data"
+	acknowledgeMessage  = "acknowledge"
+	channelClosed       = "channel_closed"
+	startPublication    = "start_publication"
+	pausePublication    = "pause_publication"
+
+	// Offsets of each field within a binary agent message
+	messageTypeLength    = 32
+	messageTypeOffset    = 4
+	schemaVersionOffset  = messageTypeOffset + messageTypeLength
+	createdDateOffset    = schemaVersionOffset + 4
+	sequenceNumberOffset = createdDateOffset + 8
+	flagsOffset          = sequenceNumberOffset + 8
+	messageIdOffset      = flagsOffset + 8
+	payloadDigestOffset  = messageIdOffset + 16
+	payloadTypeOffset    = payloadDigestOffset + 32
+	payloadLengthOffset  = payloadTypeOffset + 4
+	payloadOffset        = payloadLengthOffset + 4
+
+	// The header length excludes the payload length field itself
+	agentMessageHeaderLength = payloadLengthOffset
+
+	acknowledgeFlag = 3
+)
+
+// payloadType describes the content of a data channel message
+type payloadType uint32
+
+const (
+	payloadOutput            payloadType = 1
+	payloadError             payloadType = 2
+	payloadSize              payloadType = 3
+	payloadHandshakeRequest  payloadType = 5
+	payloadHandshakeResponse payloadType = 6
+	payloadHandshakeComplete payloadType = 7
+	payloadStdErr            payloadType = 11
+	payloadExitCode          payloadType = 12
+)
+
+// agentMessage is the binary message format exchanged with the SSM agent over the data channel
+type agentMessage struct {
+	MessageType    string
+	SchemaVersion  uint32
+	CreatedDate    uint64
+	SequenceNumber int64
+	Flags          uint64
+	MessageId      [16]byte
+	PayloadType    payloadType
+	Payload        []byte
+}
+
+// marshal encodes the message into its binary wire format
+func (m *agentMessage) marshal() []byte {
+	b := make([]byte, payloadOffset+len(m.Payload))
+	binary.BigEndian.PutUint32(b, agentMessageHeaderLength)
+	copy(b[messageTypeOffset:schemaVersionOffset], []byte(fmt.Sprintf("%-32s", m.MessageType)))
+	binary.BigEndian.PutUint32(b[schemaVersionOffset:], m.SchemaVersion)
+	binary.BigEndian.PutUint64(b[createdDateOffset:], m.CreatedDate)
+	binary.BigEndian.PutUint64(b[sequenceNumberOffset:], uint64(m.SequenceNumber))
+	binary.BigEndian.PutUint64(b[flagsOffset:], m.Flags)
+	// The agent stores the least significant half of the UUID first
+	copy(b[messageIdOffset:], m.MessageId[8:])
+	copy(b[messageIdOffset+8:], m.MessageId[:8])
+	digest := sha256.Sum256(m.Payload)
+	copy(b[payloadDigestOffset:], digest[:])
+	binary.BigEndian.PutUint32(b[payloadTypeOffset:], uint32(m.PayloadType))
+	binary.BigEndian.PutUint32(b[payloadLengthOffset:], uint32(len(m.Payload)))
+	copy(b[payloadOffset:], m.Payload)
+
+	return b
+}
+
+// unmarshalAgentMessage decodes a binary message received from the agent
+func unmarshalAgentMessage(b []byte) (*agentMessage, error) {
+	if len(b) < payloadOffset {
+		return nil, fmt.Errorf("agent message too short: %d bytes", len(b))
+	}
+	headerLength := binary.BigEndian.Uint32(b)
+	if int(headerLength)+4 > len(b) {
+		return nil, fmt.Errorf("invalid agent message header length %d", headerLength)
+	}
+
+	m := &agentMessage{
+		MessageType:    strings.TrimRight(string(b[messageTypeOffset:schemaVersionOffset]), " \x00"),
+		SchemaVersion:  binary.BigEndian.Uint32(b[schemaVersionOffset:]),
+		CreatedDate:    binary.BigEndian.Uint64(b[createdDateOffset:]),
+		SequenceNumber: int64(binary.BigEndian.Uint64(b[sequenceNumberOffset:])),
+		Flags:          binary.BigEndian.Uint64(b[flagsOffset:]),
+		PayloadType:    payloadType(binary.BigEndian.Uint32(b[payloadTypeOffset:])),
+	}
+	copy(m.MessageId[8:], b[messageIdOffset:messageIdOffset+8])
+	copy(m.MessageId[:8], b[messageIdOffset+8:payloadDigestOffset])
+
+	payloadLength := binary.BigEndian.Uint32(b[headerLength:])
+	start := int(headerLength) + 4
+	if start+int(payloadLength) > len(b) {
+		return nil, fmt.Errorf("agent message payload length %d exceeds message size", payloadLength)
+	}
+	m.Payload = b[start : start+int(payloadLength)]
+
+	return m, nil
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() [16]byte {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+
+	return u
+}
+
+// formatUUID returns the canonical string representation of a UUID
+func formatUUID(u [16]byte) string {
+	s := hex.EncodeToString(u[:])
+	return fmt.Sprintf("%s-%s-%s-%s-%s", s[0:8], s[8:12], s[12:16], s[16:20], s[20:])
+}
+
+// termSize is the payload sent to the agent when the terminal is resized
+type termSize struct {
+	Cols uint32 `json:"cols"`
+	Rows uint32 `json:"rows"`
+}
+
+// sessionClient is a connection to an SSM session's data channel
+type sessionClient struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	seq      int64 // sequence number of the next message we send
+	expected int64 // sequence number of the next output message we expect
+	pending  map[int64]*agentMessage
+
+	paused   bool
+	pausedMu sync.Mutex
+
+	handshakeComplete chan struct{}
+	handshakeOnce     sync.Once
+	done              chan struct{}
+
+	stdout   io.Writer
+	stderr   io.Writer
+	exitCode int // -1 until the agent reports the exit code of the command
+}
+
+// runNativeSession connects to an execute-command session over the SSM data channel without the
+// session-manager-plugin, relaying stdin/stdout/stderr until the session is closed. If stdin is a terminal
+// it is put into raw mode and resize events are sent to the remote shell. The exit code is -1 if the agent
+// didn't report one, e.g. because the session was dropped.
+func runNativeSession(session *ecsTypes.Session, stdin io.Reader, stdout io.Writer, stderr io.Writer) (int, error) {
+	if session == nil || session.StreamUrl == nil || session.TokenValue == nil {
+		return -1, errors.New("execute-command response did not include a session")
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(*session.StreamUrl, nil)
+	if err != nil {
+		return -1, fmt.Errorf("unable to connect to session data channel: %w", err)
+	}
+	defer conn.Close()
+
+	c := &sessionClient{
+		conn:              conn,
+		pending:           make(map[int64]*agentMessage),
+		stdout:            stdout,
+		stderr:            stderr,
+		handshakeComplete: make(chan struct{}),
+		done:              make(chan struct{}),
+		exitCode:          -1,
+	}
+	defer close(c.done)
+
+	if err := c.openDataChannel(*session.TokenValue); err != nil {
+		return -1, err
+	}
+
+	var sizes <-chan termSize
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		state, err := term.MakeRaw(int(f.Fd()))
+		if err != nil {
+			return -1, err
+		}
+		defer term.Restore(int(f.Fd()), state)
+		sizes = watchTerminalSize(int(f.Fd()), c.done)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.readLoop()
+	}()
+	go c.keepAlive()
+
+	go func() {
+		select {
+		case <-c.handshakeComplete:
+		case <-c.done:
+			return
+		}
+		if sizes == nil {
+			// Without a terminal we still need to tell the agent how big the output should be
+			c.sendInput(payloadSize, mustMarshal(termSize{Cols: 200, Rows: 50}))
+		} else {
+			go func() {
+				for size := range sizes {
+					c.sendInput(payloadSize, mustMarshal(size))
+				}
+			}()
+		}
+		if stdin != nil {
+			c.relayInput(stdin)
+		}
+	}()
+
+	err = <-errs
+
+	return c.exitCode, err
+}
+
+// openDataChannel authenticates the websocket connection using the session token
+func (c *sessionClient) openDataChannel(token string) error {
+	open := map[string]string{
+		"MessageSchemaVersion": "1.0",
+		"RequestId":            formatUUID(newUUID()),
+		"TokenValue":           token,
+		"ClientId":             formatUUID(newUUID()),
+		"ClientVersion":        sessionClientVersion,
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return c.conn.WriteMessage(websocket.TextMessage, mustMarshal(open))
+}
+
+// readLoop processes messages from the agent until the channel is closed
+func (c *sessionClient) readLoop() error {
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return nil
+			}
+			return err
+		}
+
+		msg, err := unmarshalAgentMessage(data)
+		if err != nil {
+			return err
+		}
+
+		switch msg.MessageType {
+		case outputStreamMessage:
+			if err := c.handleOutput(msg); err != nil {
+				return err
+			}
+		case channelClosed:
+			var closed struct {
+				Output string
+			}
+			json.Unmarshal(msg.Payload, &closed)
+			if closed.Output != "" {
+				fmt.Fprintf(c.stderr, "\n%s\n", closed.Output)
+			}
+			return nil
+		case startPublication:
+			c.setPaused(false)
+		case pausePublication:
+			c.setPaused(true)
+		case acknowledgeMessage:
+			// We don't retransmit input, so there is nothing to do with acknowledgements
+		}
+	}
+}
+
+// handleOutput acknowledges an output message and processes it, along with any buffered messages that
+// follow it, in sequence order
+func (c *sessionClient) handleOutput(msg *agentMessage) error {
+	if err := c.acknowledge(msg); err != nil {
+		return err
+	}
+
+	if msg.SequenceNumber < c.expected {
+		// Duplicate of a message we've already processed
+		return nil
+	}
+	c.pending[msg.SequenceNumber] = msg
+
+	for {
+		next, ok := c.pending[c.expected]
+		if !ok {
+			return nil
+		}
+		delete(c.pending, c.expected)
+		c.expected++
+		if err := c.processOutput(next); err != nil {
+			return err
+		}
+	}
+}
+
+// processOutput handles the payload of an in-order output message
+func (c *sessionClient) processOutput(msg *agentMessage) error {
+	switch msg.PayloadType {
+	case payloadOutput:
+		c.stdout.Write(msg.Payload)
+	case payloadStdErr, payloadError:
+		c.stderr.Write(msg.Payload)
+	case payloadHandshakeRequest:
+		return c.handshake(msg.Payload)
+	case payloadHandshakeComplete:
+		c.handshakeOnce.Do(func() { close(c.handshakeComplete) })
+	case payloadExitCode:
+		code, err := strconv.Atoi(strings.TrimSpace(string(msg.Payload)))
+		if err == nil {
+			c.exitCode = code
+		}
+	}
+
+	return nil
+}
+
+// handshake responds to the agent's handshake request. Only standard stream sessions are supported, sessions
+// requiring KMS encryption must use the session-manager-plugin.
+func (c *sessionClient) handshake(payload []byte) error {
+	var request struct {
+		AgentVersion           string
+		RequestedClientActions []struct {
+			ActionType string
+		}
+	}
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return fmt.Errorf("invalid handshake request: %w", err)
+	}
+
+	type processedAction struct {
+		ActionType   string
+		ActionStatus int
+		Error        string `json:",omitempty"`
+	}
+	response := struct {
+		ClientVersion          string
+		ProcessedClientActions []processedAction
+		Errors                 []string
+	}{
+		ClientVersion: sessionClientVersion,
+		Errors:        []string{},
+	}
+
+	var unsupported error
+	for _, action := range request.RequestedClientActions {
+		switch action.ActionType {
+		case "SessionType":
+			response.ProcessedClientActions = append(response.ProcessedClientActions, processedAction{ActionType: action.ActionType, ActionStatus: 1})
+		case "KMSEncryption":
+			unsupported = errors.New("the session requires KMS encryption, which is not supported by the built-in session client - install the session-manager-plugin or use --session-client plugin")
+			response.ProcessedClientActions = append(response.ProcessedClientActions, processedAction{ActionType: action.ActionType, ActionStatus: 2, Error: unsupported.Error()})
+			response.Errors = append(response.Errors, unsupported.Error())
+		default:
+			response.ProcessedClientActions = append(response.ProcessedClientActions, processedAction{ActionType: action.ActionType, ActionStatus: 3})
+		}
+	}
+
+	if err := c.sendInput(payloadHandshakeResponse, mustMarshal(response)); err != nil {
+		return err
+	}
+
+	return unsupported
+}
+
+// acknowledge tells the agent that we've received an output message
+func (c *sessionClient) acknowledge(msg *agentMessage) error {
+	ack := map[string]interface{}{
+		"AcknowledgedMessageType":           msg.MessageType,
+		"AcknowledgedMessageId":             formatUUID(msg.MessageId),
+		"AcknowledgedMessageSequenceNumber": msg.SequenceNumber,
+		"IsSequentialMessage":               true,
+	}
+
+	return c.write(&agentMessage{
+		MessageType:   acknowledgeMessage,
+		SchemaVersion: 1,
+		CreatedDate:   uint64(time.Now().UnixNano() / int64(time.Millisecond)),
+		Flags:         acknowledgeFlag,
+		MessageId:     newUUID(),
+		Payload:       mustMarshal(ack),
+	})
+}
+
+// sendInput sends a sequenced input message to the agent, waiting if the agent has paused publication
+func (c *sessionClient) sendInput(ptype payloadType, payload []byte) error {
+	for c.isPaused() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	msg := &agentMessage{
+		MessageType:    inputStreamMessage,
+		SchemaVersion:  1,
+		CreatedDate:    uint64(time.Now().UnixNano() / int64(time.Millisecond)),
+		SequenceNumber: c.seq,
+		MessageId:      newUUID(),
+		PayloadType:    ptype,
+		Payload:        payload,
+	}
+	c.seq++
+
+	return c.conn.WriteMessage(websocket.BinaryMessage, msg.marshal())
+}
+
+// write sends an unsequenced message to the agent
+func (c *sessionClient) write(msg *agentMessage) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return c.conn.WriteMessage(websocket.BinaryMessage, msg.marshal())
+}
+
+// relayInput sends everything read from stdin to the remote shell until the session is done
+func (c *sessionClient) relayInput(stdin io.Reader) {
+	// Reads block until there's input, so they're made in the background and abandoned once the session is done
+	type chunk struct {
+		data []byte
+		err  error
+	}
+	chunks := make(chan chunk)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := stdin.Read(buf)
+			select {
+			case chunks <- chunk{data: append([]byte(nil), buf[:n]...), err: err}:
+			case <-c.done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case ch := <-chunks:
+			if len(ch.data) > 0 {
+				if err := c.sendInput(payloadOutput, ch.data); err != nil {
+					return
+				}
+			}
+			if ch.err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// keepAlive periodically pings the agent so that the connection isn't closed while idle
+func (c *sessionClient) keepAlive() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.writeMu.Lock()
+			c.conn.WriteControl(websocket.PingMessage, []byte("keepalive"), time.Now().Add(10*time.Second))
+			c.writeMu.Unlock()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *sessionClient) setPaused(paused bool) {
+	c.pausedMu.Lock()
+	defer c.pausedMu.Unlock()
+	c.paused = paused
+}
+
+func (c *sessionClient) isPaused() bool {
+	c.pausedMu.Lock()
+	defer c.pausedMu.Unlock()
+	return c.paused
+}
+
+// mustMarshal encodes values that are known to be serialisable
+func mustMarshal(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,190 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentMessageRoundTrip(t *testing.T) {
+	msg := &agentMessage{
+		MessageType:    outputStreamMessage,
+		SchemaVersion:  1,
+		CreatedDate:    1700000000000,
+		SequenceNumber: 42,
+		Flags:          0,
+		MessageId:      newUUID(),
+		PayloadType:    payloadOutput,
+		Payload:        []byte("hello world"),
+	}
+
+	decoded, err := unmarshalAgentMessage(msg.marshal())
+	assert.Nil(t, err)
+	assert.Equal(t, msg, decoded)
+
+	_, err = unmarshalAgentMessage([]byte("short"))
+	assert.NotNil(t, err)
+}
+
+// agentStandIn emulates the agent side of an SSM data channel for a session which prints some output and exits,
+// reporting the exit code if one is given
+func agentStandIn(t *testing.T, received *[]*agentMessage, exitCode string) http.HandlerFunc {
+	upgrader := websocket.Upgrader{}
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade failed: %s", err)
+			return
+		}
+		defer conn.Close()
+
+		// The client must authenticate with the token before anything else
+		_, data, err := conn.ReadMessage()
+		assert.Nil(t, err)
+		var open map[string]string
+		json.Unmarshal(data, &open)
+		assert.Equal(t, "abc123", open["TokenValue"])
+
+		var seq int64
+		send := func(ptype payloadType, payload string) {
+			msg := &agentMessage{
+				MessageType:    outputStreamMessage,
+				SchemaVersion:  1,
+				SequenceNumber: seq,
+				MessageId:      newUUID(),
+				PayloadType:    ptype,
+				Payload:        []byte(payload),
+			}
+			seq++
+			conn.WriteMessage(websocket.BinaryMessage, msg.marshal())
+		}
+		read := func() *agentMessage {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return nil
+			}
+			msg, _ := unmarshalAgentMessage(data)
+			*received = append(*received, msg)
+			return msg
+		}
+
+		send(payloadHandshakeRequest, `{"AgentVersion":"3.2.0.0","RequestedClientActions":[{"ActionType":"SessionType","ActionParameters":{"SessionType":"InteractiveCommands"}}]}`)
+		read() // acknowledgement
+		read() // handshake response
+		send(payloadHandshakeComplete, `{"HandshakeTimeToComplete":1000,"CustomerMessage":""}`)
+		read() // acknowledgement
+		read() // terminal size
+		send(payloadOutput, "hello ")
+		read() // acknowledgement
+		send(payloadOutput, "world\r\n")
+		read() // acknowledgement
+		if exitCode != "" {
+			send(payloadExitCode, exitCode)
+			read() // acknowledgement
+		}
+
+		closed := &agentMessage{
+			MessageType: channelClosed,
+			MessageId:   newUUID(),
+			Payload:     []byte(`{"Output":""}`),
+		}
+		conn.WriteMessage(websocket.BinaryMessage, closed.marshal())
+	}
+}
+
+func TestRunNativeSession(t *testing.T) {
+	var received []*agentMessage
+	server := httptest.NewServer(agentStandIn(t, &received, "0"))
+	defer server.Close()
+
+	session := &ecsTypes.Session{
+		SessionId:  aws.String("ecs-execute-command-0e86561fddf625dc1"),
+		StreamUrl:  aws.String(strings.Replace(server.URL, "http", "ws", 1)),
+		TokenValue: aws.String("abc123"),
+	}
+
+	var stdout, stderr bytes.Buffer
+	exitCode, err := runNativeSession(session, nil, &stdout, &stderr)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "hello world\r\n", stdout.String())
+
+	var types []string
+	for _, m := range received {
+		types = append(types, m.MessageType)
+	}
+	assert.Equal(t, []string{acknowledgeMessage, inputStreamMessage, acknowledgeMessage, inputStreamMessage, acknowledgeMessage, acknowledgeMessage, acknowledgeMessage}, types)
+
+	// Input messages are sequenced starting from 0
+	assert.Equal(t, payloadHandshakeResponse, received[1].PayloadType)
+	assert.Equal(t, int64(0), received[1].SequenceNumber)
+	assert.Equal(t, payloadSize, received[3].PayloadType)
+	assert.Equal(t, int64(1), received[3].SequenceNumber)
+
+	var ack map[string]interface{}
+	json.Unmarshal(received[0].Payload, &ack)
+	assert.Equal(t, outputStreamMessage, ack["AcknowledgedMessageType"])
+	assert.Equal(t, float64(0), ack["AcknowledgedMessageSequenceNumber"])
+}
+
+func TestRunNativeSessionExitCode(t *testing.T) {
+	cases := []struct {
+		name     string
+		exitCode string
+		expected int
+	}{
+		{"TestRunNativeSessionFailed", "3", 3},
+		// A session which ends without reporting an exit code mustn't look successful
+		{"TestRunNativeSessionWithoutExitCode", "", -1},
+	}
+
+	for _, c := range cases {
+		var received []*agentMessage
+		server := httptest.NewServer(agentStandIn(t, &received, c.exitCode))
+		session := &ecsTypes.Session{
+			SessionId:  aws.String("ecs-execute-command-0e86561fddf625dc1"),
+			StreamUrl:  aws.String(strings.Replace(server.URL, "http", "ws", 1)),
+			TokenValue: aws.String("abc123"),
+		}
+
+		// Input which never arrives doesn't keep the session open
+		stdin, w := io.Pipe()
+		var stdout, stderr bytes.Buffer
+		exitCode, err := runNativeSession(session, stdin, &stdout, &stderr)
+		assert.Nil(t, err, c.name)
+		assert.Equal(t, c.expected, exitCode, c.name)
+		w.Close()
+		server.Close()
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+}
+
+func TestRelayInputStopsWhenDone(t *testing.T) {
+	c := &sessionClient{done: make(chan struct{})}
+	stdin, w := io.Pipe()
+	defer w.Close()
+
+	stopped := make(chan struct{})
+	go func() {
+		c.relayInput(stdin)
+		close(stopped)
+	}()
+	close(c.done)
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("relayInput was still reading stdin after the session was done")
+	}
+}
@@ -0,0 +1,39 @@
+//go:build !windows
+
+package app
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+// watchTerminalSize sends the current size of the terminal, followed by its new size whenever it is resized
+func watchTerminalSize(fd int, done <-chan struct{}) <-chan termSize {
+	sizes := make(chan termSize, 1)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGWINCH)
+
+	go func() {
+		defer signal.Stop(sigs)
+		defer close(sizes)
+		for {
+			if width, height, err := term.GetSize(fd); err == nil {
+				select {
+				case sizes <- termSize{Cols: uint32(width), Rows: uint32(height)}:
+				case <-done:
+					return
+				}
+			}
+			select {
+			case <-sigs:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return sizes
+}
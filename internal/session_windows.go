@@ -0,0 +1,43 @@
+//go:build windows
+
+package app
+
+import (
+	"time"
+
+	"golang.org/x/term"
+)
+
+// watchTerminalSize sends the current size of the terminal, followed by its new size whenever it is resized.
+// Windows has no SIGWINCH so we poll for changes instead.
+func watchTerminalSize(fd int, done <-chan struct{}) <-chan termSize {
+	sizes := make(chan termSize, 1)
+
+	go func() {
+		defer close(sizes)
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+
+		var last termSize
+		for {
+			if width, height, err := term.GetSize(fd); err == nil {
+				size := termSize{Cols: uint32(width), Rows: uint32(height)}
+				if size != last {
+					last = size
+					select {
+					case sizes <- size:
+					case <-done:
+						return
+					}
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return sizes
+}
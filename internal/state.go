@@ -0,0 +1,118 @@
+/* state.go contains the navigation engine which moves the app through the steps of choosing a container */
+
+package app
+
+import (
+	"fmt"
+)
+
+// step is a stage in the flow from choosing a cluster through to connecting to a container
+type step int
+
+const (
+	stepCluster step = iota
+	stepService
+	stepTask
+	stepContainer
+	stepExecute
+	stepExecuteFanOut
+)
+
+func (s step) String() string {
+	switch s {
+	case stepCluster:
+		return "cluster"
+	case stepService:
+		return "service"
+	case stepTask:
+		return "task"
+	case stepContainer:
+		return "container"
+	case stepExecute:
+		return "execute"
+	case stepExecuteFanOut:
+		return "executeFanOut"
+	default:
+		return fmt.Sprintf("step(%d)", int(s))
+	}
+}
+
+// transitionKind describes how the navigator moves on from a step
+type transitionKind int
+
+const (
+	moveNext transitionKind = iota // move to another step, recording this one so the user can come back to it
+	moveSkip                       // move to another step without recording this one, as the user wasn't prompted
+	moveBack                       // return to the last step the user was prompted in
+	moveDone                       // the flow is complete
+)
+
+// transition is returned by each step to tell the navigator where to go next
+type transition struct {
+	kind transitionKind
+	to   step
+}
+
+// next moves to the step after the user has made a choice in the current one
+func next(to step) transition {
+	return transition{kind: moveNext, to: to}
+}
+
+// skip moves to the step when the current one was resolved without prompting, e.g. from a flag, so that
+// going back from the next step doesn't land on it
+func skip(to step) transition {
+	return transition{kind: moveSkip, to: to}
+}
+
+var (
+	back = transition{kind: moveBack}
+	done = transition{kind: moveDone}
+)
+
+// navigator runs the steps of the app, keeping a stack of the steps the user was prompted in so that
+// choosing Back returns to the previous prompt
+type navigator struct {
+	steps   map[step]func() (transition, error)
+	history []step
+}
+
+// run executes steps from start until one completes the flow or returns an error
+func (n *navigator) run(start step) error {
+	current := start
+	for {
+		run, ok := n.steps[current]
+		if !ok {
+			return fmt.Errorf("no handler for step %s", current)
+		}
+		t, err := run()
+		if err != nil {
+			return err
+		}
+
+		switch t.kind {
+		case moveDone:
+			return nil
+		case moveNext:
+			n.history = append(n.history, current)
+			current = t.to
+		case moveSkip:
+			current = t.to
+		case moveBack:
+			current = n.pop(current)
+		}
+	}
+}
+
+// pop returns the last step the user was prompted in. If there isn't one, e.g. because the earlier steps were
+// given as flags, it returns the step before the current one so the user can choose again.
+func (n *navigator) pop(current step) step {
+	if len(n.history) > 0 {
+		previous := n.history[len(n.history)-1]
+		n.history = n.history[:len(n.history)-1]
+		return previous
+	}
+	if current > stepCluster && current <= stepContainer {
+		return current - 1
+	}
+	return stepCluster
+}
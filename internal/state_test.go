@@ -0,0 +1,178 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNavigator(t *testing.T) {
+	cases := []struct {
+		name     string
+		moves    map[step][]transition // the transitions returned by each step, in order
+		expected []step
+		err      error
+	}{
+		{
+			name: "TestNavigatorForward",
+			moves: map[step][]transition{
+				stepCluster:   {next(stepService)},
+				stepService:   {next(stepTask)},
+				stepTask:      {next(stepContainer)},
+				stepContainer: {next(stepExecute)},
+				stepExecute:   {done},
+			},
+			expected: []step{stepCluster, stepService, stepTask, stepContainer, stepExecute},
+		},
+		{
+			name: "TestNavigatorBack",
+			moves: map[step][]transition{
+				stepCluster:   {next(stepService), next(stepService)},
+				stepService:   {next(stepTask), back, next(stepTask)},
+				stepTask:      {back, next(stepContainer)},
+				stepContainer: {next(stepExecute)},
+				stepExecute:   {done},
+			},
+			expected: []step{stepCluster, stepService, stepTask, stepService, stepCluster, stepService, stepTask, stepContainer, stepExecute},
+		},
+		{
+			name: "TestNavigatorBackSkipsResolvedSteps",
+			moves: map[step][]transition{
+				stepCluster:   {next(stepService), next(stepService)},
+				stepService:   {skip(stepTask), next(stepTask)},
+				stepTask:      {back, next(stepContainer)},
+				stepContainer: {skip(stepExecute)},
+				stepExecute:   {done},
+			},
+			expected: []step{stepCluster, stepService, stepTask, stepCluster, stepService, stepTask, stepContainer, stepExecute},
+		},
+		{
+			name: "TestNavigatorBackWithoutHistory",
+			moves: map[step][]transition{
+				stepCluster: {skip(stepTask)},
+				stepTask:    {back, skip(stepContainer)},
+				stepService: {next(stepTask)},
+				stepContainer: {
+					skip(stepExecute),
+				},
+				stepExecute: {done},
+			},
+			expected: []step{stepCluster, stepTask, stepService, stepTask, stepContainer, stepExecute},
+		},
+		{
+			name: "TestNavigatorUnknownStep",
+			moves: map[step][]transition{
+				stepCluster: {next(stepExecuteFanOut)},
+			},
+			expected: []step{stepCluster},
+			err:      errors.New("no handler for step executeFanOut"),
+		},
+	}
+
+	for _, c := range cases {
+		var visited []step
+		n := &navigator{steps: map[step]func() (transition, error){}}
+		for s := range c.moves {
+			s := s
+			n.steps[s] = func() (transition, error) {
+				visited = append(visited, s)
+				move := c.moves[s][0]
+				c.moves[s] = c.moves[s][1:]
+				return move, nil
+			}
+		}
+
+		err := n.run(stepCluster)
+		assert.Equal(t, c.err, err, c.name)
+		assert.Equal(t, c.expected, visited, c.name)
+		fmt.Printf("%s PASSED\n", c.name)
+	}
+}
+
+func TestNavigatorCancelled(t *testing.T) {
+	n := &navigator{steps: map[step]func() (transition, error){
+		stepCluster: func() (transition, error) {
+			return transition{}, ErrCancelled
+		},
+		stepService: func() (transition, error) {
+			t.Fatal("the flow should have been cancelled")
+			return done, nil
+		},
+	}}
+
+	err := n.run(stepCluster)
+	assert.True(t, errors.Is(err, ErrCancelled))
+	assert.Equal(t, ExitCancelled, ExitCode(err))
+}
+
+func TestBackNavigation(t *testing.T) {
+	client := ECSClientMock{
+		ListClustersMock: func(ctx context.Context, input *ecs.ListClustersInput, optFns ...func(*ecs.Options)) (*ecs.ListClustersOutput, error) {
+			return &ecs.ListClustersOutput{ClusterArns: []string{"arn:aws:ecs:eu-west-1:111111111111:cluster/App"}}, nil
+		},
+		DescribeClustersMock: describeClustersMock,
+		ListServicesMock: func(ctx context.Context, input *ecs.ListServicesInput, optFns ...func(*ecs.Options)) (*ecs.ListServicesOutput, error) {
+			return &ecs.ListServicesOutput{ServiceArns: []string{
+				"arn:aws:ecs:eu-west-1:111111111111:service/App/api",
+				"arn:aws:ecs:eu-west-1:111111111111:service/App/worker",
+			}}, nil
+		},
+		DescribeServicesMock: describeServicesMock,
+		ListTasksMock: func(ctx context.Context, input *ecs.ListTasksInput, optFns ...func(*ecs.Options)) (*ecs.ListTasksOutput, error) {
+			return &ecs.ListTasksOutput{TaskArns: []string{fmt.Sprintf("arn:aws:ecs:eu-west-1:111111111111:task/App/%s", *input.ServiceName)}}, nil
+		},
+		DescribeTasksMock: func(ctx context.Context, input *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+			return &ecs.DescribeTasksOutput{Tasks: []ecsTypes.Task{{
+				TaskArn:    aws.String(input.Tasks[0]),
+				LaunchType: ecsTypes.LaunchTypeFargate,
+				Containers: []ecsTypes.Container{{Name: aws.String("app")}, {Name: aws.String("envoy")}},
+			}}}, nil
+		},
+	}
+
+	// The user picks the api service, backs out of its task and container, then picks the worker service
+	var prompts []string
+	app := CreateMockApp(client)
+	app.prompt = PrompterMock{
+		SelectServiceMock: func(services []ecsTypes.Service) (string, error) {
+			prompts = append(prompts, "service")
+			if len(prompts) == 1 {
+				return "api", nil
+			}
+			return "worker", nil
+		},
+		SelectTaskMock: func(tasks map[string]*ecsTypes.Task, requireExec bool) (*ecsTypes.Task, error) {
+			prompts = append(prompts, "task")
+			if len(prompts) == 4 {
+				return nil, errBack
+			}
+			return sortTasks(tasks)[0], nil
+		},
+		SelectContainerMock: func(containers []ecsTypes.Container) (*ecsTypes.Container, error) {
+			prompts = append(prompts, "container")
+			if len(prompts) == 3 {
+				return nil, errBack
+			}
+			return &containers[1], nil
+		},
+	}
+
+	viper.Set("quiet", true)
+	defer viper.Set("quiet", false)
+	n := app.navigator()
+	n.steps[stepExecute] = func() (transition, error) {
+		return done, nil
+	}
+	assert.Nil(t, n.run(stepCluster))
+	assert.Equal(t, []string{"service", "task", "container", "task", "service", "task", "container"}, prompts)
+	assert.Equal(t, "worker", app.service)
+	assert.Equal(t, "arn:aws:ecs:eu-west-1:111111111111:task/App/worker", *app.task.TaskArn)
+	assert.Equal(t, "envoy", *app.container.Name)
+}